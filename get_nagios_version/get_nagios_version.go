@@ -1,21 +1,33 @@
 package get_nagios_version
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"strings"
 
+	"github.com/hashicorp/go-version"
 	"golang.org/x/net/html"
 )
 
-func GetLatestNagiosXIVersion(NagiosXIURL string) (version string, err error) {
+// ErrVersionNotFound is returned when the versions page loaded but lists no `xi-` version, e.g after a redesign
+var ErrVersionNotFound = errors.New("no NagiosXI version found on the versions page")
+
+// the client allows callers to set a proxy and a timeout, http.DefaultClient has none and waits on an unreachable page indefinitely
+func GetLatestNagiosXIVersion(client *http.Client, NagiosXIURL string) (version string, err error) {
 
 	// Fetch the HTML source data from the URL
-	resp, err := http.Get(NagiosXIURL)
+	resp, err := client.Get(NagiosXIURL)
 	if err != nil {
 		return "", err
 	}
 	defer resp.Body.Close()
 
+	// an error page won't list any versions either, but the status says why
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("versions page returned %s", resp.Status)
+	}
+
 	// Parse the HTML data into a tree structure
 	doc, err := html.Parse(resp.Body)
 	if err != nil {
@@ -43,6 +55,28 @@ func GetLatestNagiosXIVersion(NagiosXIURL string) (version string, err error) {
 
 	// traverse the HTML parse tree and return the version if found
 	version = traverse(doc)
+	if version == "" {
+		return "", ErrVersionNotFound
+	}
 
 	return version, nil
 }
+
+// NagiosXI versions on the downloads page always start with this
+const XIVersionPrefix = "xi-"
+
+// UpdateAvailable reports whether latestVersion is newer than currentVersion, either may carry the `xi-` prefix
+// an error is returned for malformed versions so callers never act on a bogus comparison
+func UpdateAvailable(latestVersion string, currentVersion string) (bool, error) {
+	semVerLatest, err := version.NewVersion(strings.TrimPrefix(latestVersion, XIVersionPrefix))
+	if err != nil {
+		return false, fmt.Errorf("invalid latest NagiosXI version %q: %w", latestVersion, err)
+	}
+
+	semVerCurrent, err := version.NewVersion(strings.TrimPrefix(currentVersion, XIVersionPrefix))
+	if err != nil {
+		return false, fmt.Errorf("invalid current NagiosXI version %q: %w", currentVersion, err)
+	}
+
+	return semVerCurrent.LessThan(semVerLatest), nil
+}
@@ -0,0 +1,95 @@
+package livestatus
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// the fixed16 response header is a 3 digit status code, a space, the body length padded to 11 characters and a newline
+// https://docs.checkmk.com/latest/en/livestatus_references.html#heading_response_header
+const responseHeaderLength = 16
+
+// Query sends an LQL query like `GET hosts\nColumns: name state` to an MK Livestatus socket and returns the rows
+// address is either a unix socket path like /usr/local/nagios/var/rw/live or a TCP host:port
+func Query(address string, timeout time.Duration, query string) ([][]interface{}, error) {
+	network := "tcp"
+	if strings.HasPrefix(address, "/") {
+		network = "unix"
+	}
+
+	conn, err := net.DialTimeout(network, address, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+
+	// livestatus reads the query until an empty line, then closes the connection after responding
+	request := strings.TrimSpace(query) + "\nOutputFormat: json\nResponseHeader: fixed16\n\n"
+	if _, err := io.WriteString(conn, request); err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, responseHeaderLength)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return nil, fmt.Errorf("reading livestatus response header: %w", err)
+	}
+
+	status, err := strconv.Atoi(string(header[0:3]))
+	if err != nil {
+		return nil, fmt.Errorf("invalid livestatus response header %q", header)
+	}
+	length, err := strconv.Atoi(strings.TrimSpace(string(header[4:15])))
+	if err != nil {
+		return nil, fmt.Errorf("invalid livestatus response header %q", header)
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(conn, body); err != nil {
+		return nil, fmt.Errorf("reading livestatus response: %w", err)
+	}
+
+	// on errors the body is a plain text message instead of json
+	if status != 200 {
+		return nil, fmt.Errorf("livestatus returned %d: %s", status, strings.TrimSpace(string(body)))
+	}
+
+	var rows [][]interface{}
+	if err := json.Unmarshal(body, &rows); err != nil {
+		return nil, fmt.Errorf("parsing livestatus response: %w", err)
+	}
+
+	return rows, nil
+}
+
+// QueryStats runs a query made of `Stats:` lines and returns one value per `Stats:` line in order
+func QueryStats(address string, timeout time.Duration, query string) ([]float64, error) {
+	rows, err := Query(address, timeout, query)
+	if err != nil {
+		return nil, err
+	}
+
+	// stats queries without `StatsGroupBy` always respond with a single row
+	if len(rows) != 1 {
+		return nil, fmt.Errorf("expected 1 row of stats, got %d", len(rows))
+	}
+
+	stats := make([]float64, 0, len(rows[0]))
+	for _, v := range rows[0] {
+		stat, ok := v.(float64)
+		if !ok {
+			return nil, fmt.Errorf("unexpected stats value %v", v)
+		}
+		stats = append(stats, stat)
+	}
+
+	return stats, nil
+}
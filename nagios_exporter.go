@@ -2,34 +2,90 @@ package main
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"errors"
 	"flag"
+	"fmt"
+	"html"
 	"io"
+	"math"
+	"net"
 	"net/http"
+	"net/url"
+	"os"
 	"os/exec"
+	"os/signal"
+	"path"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/linode-obs/nagios_exporter/get_nagios_version"
+	"github.com/linode-obs/nagios_exporter/livestatus"
+	"github.com/linode-obs/nagios_exporter/parse_api_response"
+	"github.com/linode-obs/nagios_exporter/parse_nagiostats"
+	"github.com/linode-obs/nagios_exporter/parse_perfdata"
+	"github.com/linode-obs/nagios_exporter/parse_statusdat"
+	"github.com/linode-obs/nagios_exporter/redact"
+	"github.com/linode-obs/nagios_exporter/status_counts"
 
 	"github.com/BurntSushi/toml"
-	"github.com/hashicorp/go-version"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/exporter-toolkit/web"
 	log "github.com/sirupsen/logrus"
+	"golang.org/x/sync/singleflight"
 )
 
+// --web.listen-address of e.g `unix:/run/nagios_exporter.sock` serves metrics on a unix socket instead of TCP
+const unixSocketPrefix = "unix:"
+
 // https://stackoverflow.com/a/16491396
 type Config struct {
 	APIKey string
+	// HTTP basic auth, e.g for a reverse proxy in front of Nagios XI
+	Username  string
+	Password  string
+	Targets   []Target
+	Instances []Instance
+}
+
+// Additional Nagios XI instances that can be scraped with the `target` URL parameter
+type Target struct {
+	ScrapeURI string
+	APIKey    string
+}
+
+// Nagios XI instances scraped together on every /metrics scrape, each metric labelled with `instance` set to the Name
+type Instance struct {
+	Name      string
+	ScrapeURI string
+	APIKey    string
+}
+
+// find the API key of a target, trailing slashes are ignored so `http://nagios/` matches `http://nagios`
+func (c Config) TargetAPIKey(scrapeURI string) (string, bool) {
+	for _, t := range c.Targets {
+		if strings.TrimSuffix(t.ScrapeURI, "/") == strings.TrimSuffix(scrapeURI, "/") {
+			return t.APIKey, true
+		}
+	}
+	return "", false
 }
 
 const namespace = "nagios"
 
+// overrides the APIKey from the configuration file
+const apiKeyEnvVar = "NAGIOS_API_KEY"
+
 // NagiosXI specific API endpoints
 const nagiosAPIVersion = "/nagiosxi"
 const apiSlug = "/api/v1"
@@ -40,6 +96,26 @@ const systemstatusAPI = "/system/status"
 const systemstatusDetailAPI = "/system/statusdetail"
 const systemuserAPI = "/system/user"
 
+// the plain /objects/hostgroup and /objects/servicegroup endpoints don't include members
+const hostgroupmembersAPI = "/objects/hostgroupmembers"
+const servicegroupmembersAPI = "/objects/servicegroupmembers"
+const downtimeAPI = "/objects/downtime"
+const contactAPI = "/objects/contact"
+const commentAPI = "/objects/comment"
+const statehistoryAPI = "/objects/statehistory"
+
+// objects/contactgroup has no members, only the group definitions
+const contactgroupmembersAPI = "/objects/contactgroupmembers"
+
+// how far every state history query reaches back before the last one, for state changes Nagios writes late
+const alertsLateMargin = 5 * time.Minute
+
+// records per page of the state history when --nagios.page-size is 0
+const statehistoryPageSize = 1000
+
+// format of timestamps like last_check in the objects APIs, in the Nagios server's local time
+const nagiosTimeLayout = "2006-01-02 15:04:05"
+
 type systemStatus struct {
 	// https://stackoverflow.com/questions/21151765/cannot-unmarshal-string-into-go-value-of-type-int64
 	Running float64 `json:"is_currently_running,string"`
@@ -78,11 +154,22 @@ type systemStatusDetail struct {
 			Val15 float64 `json:"val15,string"`
 			Val5  float64 `json:"val5,string"`
 		} `json:"passivehostchecks"`
+		// passive checks are submitted results, so they have no execution time
+		Passivehostcheckperf struct {
+			AvgLatency float64 `json:"avg_latency,string"`
+			MaxLatency float64 `json:"max_latency,string"`
+			MinLatency float64 `json:"min_latency,string"`
+		} `json:"passivehostcheckperf"`
 		Passiveservicechecks struct {
 			Val1  float64 `json:"val1,string"`
 			Val15 float64 `json:"val15,string"`
 			Val5  float64 `json:"val5,string"`
 		} `json:"passiveservicechecks"`
+		Passiveservicecheckperf struct {
+			AvgLatency float64 `json:"avg_latency,string"`
+			MaxLatency float64 `json:"max_latency,string"`
+			MinLatency float64 `json:"min_latency,string"`
+		} `json:"passiveservicecheckperf"`
 		Updated string `json:"updated"`
 	} `json:"nagioscore"`
 }
@@ -95,29 +182,30 @@ type systemInfo struct {
 type hostStatus struct {
 	Recordcount float64 `json:"recordcount"`
 	Hoststatus  []struct {
-		HostObjectID               float64 `json:"host_object_id,string"`
-		CheckType                  float64 `json:"check_type,string"`
-		CurrentState               float64 `json:"current_state,string"`
-		IsFlapping                 float64 `json:"is_flapping,string"`
-		ScheduledDowntimeDepth     float64 `json:"scheduled_downtime_depth,string"`
-		ProblemHasBeenAcknowledged float64 `json:"problem_has_been_acknowledged,string"`
-		Latency                    float64 `json:"latency,string"`
-		ExecutionTime              float64 `json:"execution_time,string"`
+		// the counted fields, e.g check_type and current_state
+		status_counts.Host
+		HostName        string  `json:"host_name"`
+		HostObjectID    float64 `json:"host_object_id,string"`
+		Latency         float64 `json:"latency,string"`
+		ExecutionTime   float64 `json:"execution_time,string"`
+		LastCheck       string  `json:"last_check"`
+		LastStateChange string  `json:"last_state_change"`
 	} `json:"hoststatus"`
 }
 
 type serviceStatus struct {
 	Recordcount   float64 `json:"recordcount"`
 	Servicestatus []struct {
-		HasBeenChecked             float64 `json:"has_been_checked,string"`
-		ShouldBeScheduled          float64 `json:"should_be_scheduled,string"`
-		CheckType                  float64 `json:"check_type,string"`
-		CurrentState               float64 `json:"current_state,string"`
-		IsFlapping                 float64 `json:"is_flapping,string"`
-		ScheduledDowntimeDepth     float64 `json:"scheduled_downtime_depth,string"`
-		ProblemHasBeenAcknowledged float64 `json:"problem_has_been_acknowledged,string"`
-		Latency                    float64 `json:"latency,string"`
-		ExecutionTime              float64 `json:"execution_time,string"`
+		// the counted fields, e.g check_type and current_state
+		status_counts.Service
+		HostName           string  `json:"host_name"`
+		ServiceDescription string  `json:"service_description"`
+		HasBeenChecked     float64 `json:"has_been_checked,string"`
+		Latency            float64 `json:"latency,string"`
+		ExecutionTime      float64 `json:"execution_time,string"`
+		Perfdata           string  `json:"perfdata"`
+		LastCheck          string  `json:"last_check"`
+		LastStateChange    string  `json:"last_state_change"`
 	} `json:"servicestatus"`
 }
 
@@ -130,15 +218,126 @@ type userStatus struct {
 	} `json:"users"`
 }
 
-func ReadConfig(configPath string) Config {
+type hostgroupMembers struct {
+	Hostgroup []struct {
+		HostgroupName string `json:"hostgroup_name"`
+		Members       struct {
+			Host []struct {
+				HostName string `json:"host_name"`
+			} `json:"host"`
+		} `json:"members"`
+	} `json:"hostgroup"`
+}
+
+type servicegroupMembers struct {
+	Servicegroup []struct {
+		ServicegroupName string `json:"servicegroup_name"`
+		Members          struct {
+			Service []struct {
+				HostName           string `json:"host_name"`
+				ServiceDescription string `json:"service_description"`
+			} `json:"service"`
+		} `json:"members"`
+	} `json:"servicegroup"`
+}
+
+type scheduledDowntime struct {
+	Scheduleddowntime []struct {
+		// 1 service, 2 host
+		DowntimeType float64 `json:"downtime_type,string"`
+		// 0 until the downtime starts, flexible downtimes may start after scheduled_start_time
+		WasStarted float64 `json:"was_started,string"`
+	} `json:"scheduleddowntime"`
+}
+
+// Nagios XI converts its XML backend to JSON, so an empty element like the service_description of a host comment is `{}` instead of ""
+type optionalString string
+
+func (s *optionalString) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err != nil {
+		*s = ""
+		return nil
+	}
+	*s = optionalString(str)
+	return nil
+}
+
+type comments struct {
+	Comment []struct {
+		// 1 host, 2 service
+		CommentType float64 `json:"comment_type,string"`
+		// 1 user comment, 2 downtime, 3 flapping, 4 acknowledgement
+		EntryType          float64        `json:"entry_type,string"`
+		HostName           optionalString `json:"host_name"`
+		ServiceDescription optionalString `json:"service_description"`
+		AuthorName         optionalString `json:"author_name"`
+		EntryTime          string         `json:"entry_time"`
+	} `json:"comment"`
+}
+
+type statehistory struct {
+	Stateentry []stateentry `json:"stateentry"`
+}
+
+// every field identifying a state change, so an entry returned again by an overlapping query can be told apart
+type stateentry struct {
+	StateTime          string         `json:"state_time"`
+	ObjectID           string         `json:"object_id"`
+	HostName           optionalString `json:"host_name"`
+	ServiceDescription optionalString `json:"service_description"`
+	// 1 host, 2 service
+	ObjecttypeID float64 `json:"objecttype_id,string"`
+	State        float64 `json:"state,string"`
+	StateType    float64 `json:"state_type,string"`
+}
+
+type contacts struct {
+	Contact []struct {
+		ContactName                 string  `json:"contact_name"`
+		HostNotificationsEnabled    float64 `json:"host_notifications_enabled,string"`
+		ServiceNotificationsEnabled float64 `json:"service_notifications_enabled,string"`
+	} `json:"contact"`
+}
+
+type contactgroupMembers struct {
+	Contactgroup []struct {
+		ContactgroupName string `json:"contactgroup_name"`
+		Members          struct {
+			Contact []struct {
+				ContactName string `json:"contact_name"`
+			} `json:"contact"`
+		} `json:"members"`
+	} `json:"contactgroup"`
+}
+
+func ReadConfig(configPath string) (Config, error) {
 
 	var conf Config
 
 	if _, err := toml.DecodeFile(configPath, &conf); err != nil {
-		log.Fatal(err)
+		return conf, err
+	}
+
+	return conf, nil
+}
+
+// precedence is --config.api-key-file, then the NAGIOS_API_KEY environment variable, then the configuration file
+func ResolveAPIKey(conf Config, apiKeyFile string) (string, error) {
+	if apiKeyFile != "" {
+		apiKey, err := os.ReadFile(apiKeyFile)
+		if err != nil {
+			return "", err
+		}
+		// secrets are often written with a trailing newline
+		return strings.TrimSpace(string(apiKey)), nil
+	}
+
+	if apiKey, ok := os.LookupEnv(apiKeyEnvVar); ok {
+		return strings.TrimSpace(apiKey), nil
 	}
 
-	return conf
+	return conf.APIKey, nil
 }
 
 var (
@@ -147,38 +346,97 @@ var (
 	BuildDate string
 	Commit    string
 
+	// set once when the exporter starts
+	startTime = time.Now()
+	// unix time of the last successful configuration file load, at startup or on a SIGHUP, 0 until one happened
+	configLastReload atomic.Int64
+
 	// Metrics
 	up = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "up"), "Whether Nagios can be reached", nil, nil)
+	// endpoint is the last element of the API path, e.g servicestatus for /objects/servicestatus
+	apiUp = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "api_up"), "Whether the last query of a Nagios XI API endpoint succeeded", []string{"endpoint"}, nil)
+	// positive when the API returned fewer records than its recordcount, e.g a truncated servicestatus
+	apiRecordcountMismatch = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "api_recordcount_mismatch"), "Records a Nagios XI API endpoint reported in its recordcount minus the records it returned", []string{"endpoint"}, nil)
+
+	// Scrape
+	scrapeDuration = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "scrape_duration_seconds"), "Time taken to scrape Nagios", nil, nil)
+	scrapeErrors   = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "scrape_errors_total"), "Amount of errors querying or parsing a Nagios endpoint", nil, nil)
 
 	// Hosts
-	hostsTotal                = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "hosts_total"), "Amount of hosts present in configuration", nil, nil)
-	hostsCheckedTotal         = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "hosts_checked_total"), "Amount of hosts checked", []string{"check_type"}, nil)
-	hostsStatus               = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "hosts_status_total"), "Amount of hosts in different states", []string{"status"}, nil)
+	hostsTotal        = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "hosts_total"), "Amount of hosts present in configuration", nil, nil)
+	hostsCheckedTotal = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "hosts_checked_total"), "Amount of hosts checked", []string{"check_type"}, nil)
+	hostsStatus       = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "hosts_status_total"), "Amount of hosts in different states", []string{"status"}, nil)
+	// every downtime, including nested and future ones, unlike hosts_downtime_total and services_downtime_total
+	downtimesTotal = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "downtimes_total"), "Amount of scheduled downtimes", []string{"type", "state"}, nil)
+	// comments of every entry_type, including the ones Nagios adds for downtimes, flapping and acknowledgements
+	commentsTotal = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "comments_total"), "Amount of host and service comments", []string{"type"}, nil)
+	alertsTotal   = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "alerts_total"), "Amount of host and service state changes", []string{"type", "state"}, nil)
+	// a series per acknowledgement, from the comment Nagios adds when a problem is acknowledged
+	acknowledgementAge        = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "acknowledgement_age_seconds"), "Time since a problem was acknowledged", []string{"type", "host_name", "service_description", "author"}, nil)
 	hostsDowntime             = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "hosts_downtime_total"), "Amount of hosts in downtime", nil, nil)
-	hostsProblemsAcknowledged = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "hosts_acknowledges_total"), "Amount of host problems acknowledged", nil, nil)
+	hostsProblemsAcknowledged = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "hosts_acknowledges_total"), "Amount of host problems acknowledged", []string{"status"}, nil)
+	// only hard states, which are confirmed after max_attempts, unlike soft states on a first failure
+	hostsHardStatus            = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "hosts_hard_state_total"), "Amount of hosts in different hard states", []string{"status"}, nil)
+	hostsNotificationsDisabled = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "hosts_notifications_disabled_total"), "Amount of hosts with notifications disabled", nil, nil)
+	hostsChecksDisabled        = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "hosts_checks_disabled_total"), "Amount of hosts with active checks disabled", nil, nil)
+	// soft states past the first attempt, which turn hard (and usually notify) if they persist until max_attempts
+	hostsRetrying = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "hosts_retrying_total"), "Amount of hosts in a soft state past their first check attempt", nil, nil)
 	// naming is a little inconsistent but matches system detail buckets... whoops
 	hostsCheckLatency   = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "host_checks_latency"), "Host check latency", []string{"check_type", "performance_type"}, nil)
 	hostsCheckExecution = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "host_checks_execution"), "Host check execution", []string{"check_type", "performance_type"}, nil)
 
 	// Services
-	servicesTotal                = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "services_total"), "Amount of services present in configuration", nil, nil)
-	servicesCheckedTotal         = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "services_checked_total"), "Amount of services checked", []string{"check_type"}, nil)
-	servicesStatus               = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "services_status_total"), "Amount of services in different states", []string{"status"}, nil)
-	servicesDowntime             = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "services_downtime_total"), "Amount of services in downtime", nil, nil)
-	servicesProblemsAcknowledged = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "services_acknowledges_total"), "Amount of service problems acknowledged", nil, nil)
-	servicesCheckLatency         = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "service_checks_latency"), "Service check latency", []string{"check_type", "performance_type"}, nil)
-	servicesCheckExecution       = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "service_checks_execution"), "Service check execution", []string{"check_type", "performance_type"}, nil)
+	servicesTotal                 = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "services_total"), "Amount of services present in configuration", nil, nil)
+	servicesCheckedTotal          = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "services_checked_total"), "Amount of services checked", []string{"check_type"}, nil)
+	servicesStatus                = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "services_status_total"), "Amount of services in different states", []string{"status"}, nil)
+	servicesDowntime              = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "services_downtime_total"), "Amount of services in downtime", nil, nil)
+	servicesProblemsAcknowledged  = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "services_acknowledges_total"), "Amount of service problems acknowledged", []string{"status"}, nil)
+	servicesHardStatus            = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "services_hard_state_total"), "Amount of services in different hard states", []string{"status"}, nil)
+	servicesNotificationsDisabled = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "services_notifications_disabled_total"), "Amount of services with notifications disabled", nil, nil)
+	servicesChecksDisabled        = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "services_checks_disabled_total"), "Amount of services with active checks disabled", nil, nil)
+	servicesScheduled             = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "services_scheduled_total"), "Amount of services Nagios schedules active checks for", nil, nil)
+	servicesRetrying              = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "services_retrying_total"), "Amount of services in a soft state past their first check attempt", nil, nil)
+	servicesCheckLatency          = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "service_checks_latency"), "Service check latency", []string{"check_type", "performance_type"}, nil)
+	servicesCheckExecution        = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "service_checks_execution"), "Service check execution", []string{"check_type", "performance_type"}, nil)
+	// optional per-host metrics, as Unix timestamps so staleness is `time() - nagios_host_last_check_timestamp_seconds`
+	hostLastCheck       = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "host_last_check_timestamp_seconds"), "Time of the last check of each host", []string{"host_name"}, nil)
+	hostLastStateChange = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "host_last_state_change_timestamp_seconds"), "Time of the last state change of each host", []string{"host_name"}, nil)
+	// optional per-host metrics, 1 when enabled and 0 when disabled
+	hostNotificationsEnabled = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "host_notifications_enabled"), "Whether notifications are enabled for each host", []string{"host_name"}, nil)
+	hostActiveChecksEnabled  = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "host_active_checks_enabled"), "Whether active checks are enabled for each host", []string{"host_name"}, nil)
+	// optional per-host metrics, a host goes hard when current_attempt reaches max_attempts
+	hostCurrentAttempt = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "host_current_attempt"), "Current check attempt of each host", []string{"host_name"}, nil)
+	hostMaxAttempts    = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "host_max_attempts"), "Check attempts before each host enters a hard state", []string{"host_name"}, nil)
+	// optional per-service metric, status is the current state plus flapping/acknowledged when applicable
+	serviceState = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "service_state"), "Current state of each service", []string{"host_name", "service_description", "status"}, nil)
+	// optional per-service metric, label is the perfdata label and unit its normalized unit of measurement
+	servicePerfdata = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "service_perfdata"), "Service check performance data", []string{"host_name", "service_description", "label", "unit"}, nil)
+	// optional per-service metrics
+	serviceLastCheck            = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "service_last_check_timestamp_seconds"), "Time of the last check of each service", []string{"host_name", "service_description"}, nil)
+	serviceLastStateChange      = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "service_last_state_change_timestamp_seconds"), "Time of the last state change of each service", []string{"host_name", "service_description"}, nil)
+	serviceNotificationsEnabled = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "service_notifications_enabled"), "Whether notifications are enabled for each service", []string{"host_name", "service_description"}, nil)
+	serviceActiveChecksEnabled  = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "service_active_checks_enabled"), "Whether active checks are enabled for each service", []string{"host_name", "service_description"}, nil)
+	serviceCurrentAttempt       = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "service_current_attempt"), "Current check attempt of each service", []string{"host_name", "service_description"}, nil)
+	serviceMaxAttempts          = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "service_max_attempts"), "Check attempts before each service enters a hard state", []string{"host_name", "service_description"}, nil)
 
 	// System
 	versionInfo = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "version_info"), "Nagios version information", []string{"version"}, nil)
 	buildInfo   = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "build_info"), "Nagios exporter build information", []string{"version", "build_date", "commit"}, nil)
+	// plain timestamps are easier to alert on than restarts hidden in the build_info labels
+	exporterStartTime = prometheus.NewDesc(prometheus.BuildFQName(namespace, "exporter", "start_time_seconds"), "Time the Nagios exporter started", nil, nil)
+	configReloadTime  = prometheus.NewDesc(prometheus.BuildFQName(namespace, "exporter", "config_last_reload_timestamp_seconds"), "Time the Nagios exporter configuration file was last loaded", nil, nil)
 
 	// System Detail
+	// not a distribution of latencies, the 1/5/15 buckets are the amount of checks within the last 1, 5 and 15 minutes
+	// as reported by Nagios, which can't be rebucketed. Don't use histogram_quantile on these
 	hostchecks    = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "host_checks_minutes"), "Host checks over time", []string{"check_type"}, nil)
 	servicechecks = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "service_checks_minutes"), "Service checks over time", []string{"check_type"}, nil)
+	// active and passive checks per second over the last 5 minutes
+	hostChecksRate    = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "host_checks_rate"), "Host checks per second over the last 5 minutes", nil, nil)
+	serviceChecksRate = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "service_checks_rate"), "Service checks per second over the last 5 minutes", nil, nil)
 	// operator is min/max/avg exposed by Nagios XI API
 	// performance_type is latency/execution
-	// technically there is no such thing as a check_type of passive for these metrics
+	// passive checks only have a latency, there is no execution performance_type for them
 	hostchecksPerformance    = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "host_checks_performance_seconds"), "Host checks performance", []string{"check_type", "performance_type", "operator"}, nil)
 	servicechecksPerformance = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "service_checks_performance_seconds"), "Service checks performance", []string{"check_type", "performance_type", "operator"}, nil)
 
@@ -187,91 +445,312 @@ var (
 	usersPrivileges = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "users_privileges_total"), "Amount of admin or regular users", []string{"privileges"}, nil)
 	usersStatus     = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "users_status_total"), "Amount of disabled or enabled users", []string{"status"}, nil)
 
+	// Groups
+	hostgroupMembersTotal    = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "hostgroup_members_total"), "Amount of hosts in a host group", []string{"hostgroup"}, nil)
+	servicegroupMembersTotal = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "servicegroup_members_total"), "Amount of services in a service group", []string{"servicegroup"}, nil)
+
+	// Contacts
+	// type is host or service, a contact has separate host and service notification settings
+	contactsTotal                                = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "contacts_total"), "Amount of contacts present in configuration", nil, nil)
+	contactsNotificationsEnabled                 = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "contacts_notifications_enabled_total"), "Amount of contacts with notifications enabled", []string{"type"}, nil)
+	contactgroupMembersTotal                     = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "contactgroup_members_total"), "Amount of contacts in a contact group", []string{"contactgroup"}, nil)
+	contactgroupMembersNotificationsEnabledTotal = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "contactgroup_members_notifications_enabled_total"), "Amount of contacts in a contact group with host or service notifications enabled", []string{"contactgroup"}, nil)
+
 	// Optional metric
-	updateAvailable = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "update_available_info"), "NagiosXI update is available", nil, nil)
+	updateAvailable = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "update_available_info"), "NagiosXI update is available", []string{"running_version", "latest_version"}, nil)
 
+	// default for --nagios.check-updates-url
 	NagiosXIURL = "https://assets.nagios.com/downloads/nagiosxi/versions.php"
 )
 
+// Which endpoints are queried, set by the --collector.* flags
+type Collectors struct {
+	HostStatus    bool
+	ServiceStatus bool
+	StatusDetail  bool
+	Users         bool
+	Groups        bool
+	Downtime      bool
+	Comments      bool
+	Contacts      bool
+	Alerts        bool
+}
+
 type Exporter struct {
-	nagiosEndpoint, nagiosAPIKey string
-	sslVerify                    bool
-	nagiosAPITimeout             time.Duration
-	nagiostatsPath               string
-	nagiosconfigPath             string
-	checkUpdates                 bool
+	nagiosEndpoint string
+	// the credentials can be swapped by a SIGHUP configuration reload while Collect is running
+	credentialsMutex               sync.RWMutex
+	nagiosAPIKey                   string
+	nagiosUsername, nagiosPassword string
+	nagiosProxyURL                 *url.URL
+	userAgent                      string
+	headers                        http.Header
+	nagiosAPITimeout               time.Duration
+	nagiostatsPath                 string
+	nagiosconfigPath               string
+	livestatusSocket               string
+	statusFile                     string
+	checkUpdates                   bool
+	checkUpdatesURL                string
+	perHost                        bool
+	perService                     bool
+	perfdata                       bool
+	latencyBuckets                 []float64
+	collectors                     Collectors
+	// shared by every API request so connections to Nagios, and their TLS sessions, are reused across scrapes
+	client *http.Client
+	// fetches --nagios.check-updates-url
+	updatesClient *http.Client
+	// records requested per page of hoststatus and servicestatus, 0 requests every object at once
+	pageSize int
+	// nagios_alerts_total counts the state history from alertsLookback before the first scrape onwards,
+	// every scrape only adding the state changes since alertsSince, less alertsLateMargin
+	alertsLookback time.Duration
+	alertsMutex    sync.Mutex
+	alertsSince    int64
+	alertCounts    map[[2]string]float64
+	// the state changes already counted within the margin, with when they were first counted
+	alertsCounted map[stateentry]int64
+	// extra attempts of a Nagios API request failing transiently
+	retries int
+	// query sends the API key as the apikey URL parameter, header as the X-API-KEY header
+	authMode string
+	// cumulative across scrapes, incremented concurrently by the API queries
+	scrapeErrorCount atomic.Uint64
+	// cumulative across scrapes like scrapeErrorCount, so it's a histogram kept by the exporter rather than a const metric
+	apiRequestDuration *prometheus.HistogramVec
+	// raw API response bodies keyed by URL, only used when cacheTTL > 0
+	cacheTTL   time.Duration
+	cacheMutex sync.Mutex
+	cache      map[string]cachedResponse
+	// coalesces concurrent scrapes missing the cache into a single upstream request per URL
+	cacheGroup singleflight.Group
+	// coalesces overlapping scrapes into a single Collect
+	collectGroup singleflight.Group
+}
+
+type cachedResponse struct {
+	body    []byte
+	expires time.Time
 }
 
-func NewExporter(nagiosEndpoint, nagiosAPIKey string, sslVerify bool, nagiosAPITimeout time.Duration, nagiostatsPath string, nagiosconfigPath string, checkUpdates bool) *Exporter {
+// ExporterOptions configures NewExporter, built once in main from the flags and the configuration file
+type ExporterOptions struct {
+	// base URL of Nagios XI like --nagios.scrape-uri, the API path is appended
+	ScrapeURI           string
+	APIKey              string
+	Username, Password  string
+	ProxyURL            *url.URL
+	TLSConfig           *tls.Config
+	UserAgent           string
+	Headers             http.Header
+	APITimeout          time.Duration
+	NagiostatsPath      string
+	NagiosConfigPath    string
+	LivestatusSocket    string
+	StatusFile          string
+	CheckUpdates        bool
+	CheckUpdatesURL     string
+	CheckUpdatesTimeout time.Duration
+	PerHost, PerService bool
+	Perfdata            bool
+	LatencyBuckets      []float64
+	Collectors          Collectors
+	CacheTTL            time.Duration
+	PageSize            int
+	AlertsLookback      time.Duration
+	Retries             int
+	AuthMode            string
+}
+
+func NewExporter(opts ExporterOptions) *Exporter {
 	return &Exporter{
-		nagiosEndpoint:   nagiosEndpoint,
-		nagiosAPIKey:     nagiosAPIKey,
-		sslVerify:        sslVerify,
-		nagiosAPITimeout: nagiosAPITimeout,
-		nagiostatsPath:   nagiostatsPath,
-		nagiosconfigPath: nagiosconfigPath,
-		checkUpdates:     checkUpdates,
+		nagiosEndpoint:   strings.TrimSuffix(opts.ScrapeURI, "/") + nagiosAPIVersion + apiSlug,
+		nagiosAPIKey:     opts.APIKey,
+		nagiosUsername:   opts.Username,
+		nagiosPassword:   opts.Password,
+		nagiosProxyURL:   opts.ProxyURL,
+		client:           newAPIClient(opts.ProxyURL, opts.TLSConfig, opts.APITimeout),
+		updatesClient:    newUpdatesClient(opts.ProxyURL, opts.CheckUpdatesTimeout),
+		userAgent:        opts.UserAgent,
+		headers:          opts.Headers,
+		nagiosAPITimeout: opts.APITimeout,
+		nagiostatsPath:   opts.NagiostatsPath,
+		nagiosconfigPath: opts.NagiosConfigPath,
+		livestatusSocket: opts.LivestatusSocket,
+		statusFile:       opts.StatusFile,
+		checkUpdates:     opts.CheckUpdates,
+		checkUpdatesURL:  opts.CheckUpdatesURL,
+		perHost:          opts.PerHost,
+		perService:       opts.PerService,
+		perfdata:         opts.Perfdata,
+		latencyBuckets:   opts.LatencyBuckets,
+		collectors:       opts.Collectors,
+		cacheTTL:         opts.CacheTTL,
+		pageSize:         opts.PageSize,
+		alertsLookback:   opts.AlertsLookback,
+		retries:          opts.Retries,
+		authMode:         opts.AuthMode,
+		cache:            make(map[string]cachedResponse),
+		apiRequestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "api_request_duration_seconds",
+			Help:      "Duration of requests to a Nagios XI API endpoint",
+			// servicestatus of large installations can take tens of seconds
+			Buckets: []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+		}, []string{"endpoint"}),
 	}
 }
 
+// SetCredentials swaps in the credentials of a reloaded configuration, scrapes in progress finish with the old ones
+func (e *Exporter) SetCredentials(nagiosAPIKey, nagiosUsername, nagiosPassword string) {
+	e.credentialsMutex.Lock()
+	defer e.credentialsMutex.Unlock()
+
+	e.nagiosAPIKey = nagiosAPIKey
+	e.nagiosUsername = nagiosUsername
+	e.nagiosPassword = nagiosPassword
+}
+
+func (e *Exporter) credentials() (nagiosAPIKey, nagiosUsername, nagiosPassword string) {
+	e.credentialsMutex.RLock()
+	defer e.credentialsMutex.RUnlock()
+
+	return e.nagiosAPIKey, e.nagiosUsername, e.nagiosPassword
+}
+
 func (e *Exporter) Describe(ch chan<- *prometheus.Desc) {
 	// Nagios status
 	ch <- up
+	if e.nagiostatsPath == "" && e.livestatusSocket == "" && e.statusFile == "" {
+		ch <- apiUp
+		ch <- apiRecordcountMismatch
+		e.apiRequestDuration.Describe(ch)
+	}
+	// Scrape
+	ch <- scrapeDuration
+	ch <- scrapeErrors
 	// Hosts
-	ch <- hostsTotal
-	ch <- hostsStatus
-	ch <- hostsDowntime
-	if e.nagiostatsPath == "" {
-		// metrics only available from the API, no `nagiostats` support
-		ch <- hostsProblemsAcknowledged
+	if e.collectors.HostStatus {
+		ch <- hostsTotal
 		ch <- hostsCheckedTotal
-		ch <- hostsCheckLatency
-		ch <- hostsCheckExecution
+		ch <- hostsStatus
+		ch <- hostsDowntime
+		if e.nagiostatsPath == "" {
+			// metrics only available from the API, no `nagiostats` support
+			ch <- hostsProblemsAcknowledged
+			ch <- hostsCheckLatency
+			ch <- hostsCheckExecution
+			ch <- hostsHardStatus
+			ch <- hostsNotificationsDisabled
+			ch <- hostsChecksDisabled
+			ch <- hostsRetrying
+			ch <- hostLastCheck
+			ch <- hostLastStateChange
+			ch <- hostNotificationsEnabled
+			ch <- hostActiveChecksEnabled
+			ch <- hostCurrentAttempt
+			ch <- hostMaxAttempts
+		}
 	}
 	// Services
-	ch <- servicesTotal
-	ch <- servicesStatus
-	ch <- servicesDowntime
-	if e.nagiostatsPath == "" {
-		ch <- servicesProblemsAcknowledged
+	if e.collectors.ServiceStatus {
+		ch <- servicesTotal
 		ch <- servicesCheckedTotal
-		ch <- servicesCheckLatency
-		ch <- servicesCheckExecution
+		ch <- servicesStatus
+		ch <- servicesDowntime
+		if e.nagiostatsPath == "" {
+			ch <- servicesProblemsAcknowledged
+			ch <- servicesCheckLatency
+			ch <- servicesCheckExecution
+			ch <- serviceState
+			ch <- servicePerfdata
+			ch <- servicesHardStatus
+			ch <- servicesNotificationsDisabled
+			ch <- servicesChecksDisabled
+			ch <- servicesScheduled
+			ch <- servicesRetrying
+			ch <- serviceLastCheck
+			ch <- serviceLastStateChange
+			ch <- serviceNotificationsEnabled
+			ch <- serviceActiveChecksEnabled
+			ch <- serviceCurrentAttempt
+			ch <- serviceMaxAttempts
+		}
 	}
 	// System
 	ch <- versionInfo
 	ch <- buildInfo
+	ch <- exporterStartTime
+	ch <- configReloadTime
 	// System Detail
-	ch <- hostchecks
-	ch <- servicechecks
-	ch <- hostchecksPerformance
-	ch <- servicechecksPerformance
+	if e.collectors.StatusDetail {
+		ch <- hostchecks
+		ch <- servicechecks
+		ch <- hostChecksRate
+		ch <- serviceChecksRate
+		ch <- hostchecksPerformance
+		ch <- servicechecksPerformance
+	}
 	// Users
-	if e.nagiostatsPath == "" {
+	if e.nagiostatsPath == "" && e.collectors.Users {
 		// we cannot get user information from Nagios Core 3/4
 		ch <- usersTotal
 		ch <- usersPrivileges
 		ch <- usersStatus
 	}
+	// Groups
+	if e.nagiostatsPath == "" && e.collectors.Groups {
+		// nagiostats has no notion of group membership
+		ch <- hostgroupMembersTotal
+		ch <- servicegroupMembersTotal
+	}
+	// Downtime
+	if e.nagiostatsPath == "" && e.livestatusSocket == "" && e.statusFile == "" && e.collectors.Downtime {
+		ch <- downtimesTotal
+	}
+	// Comments
+	if e.nagiostatsPath == "" && e.livestatusSocket == "" && e.statusFile == "" && e.collectors.Comments {
+		ch <- commentsTotal
+		ch <- acknowledgementAge
+	}
+	// Alerts
+	if e.nagiostatsPath == "" && e.livestatusSocket == "" && e.statusFile == "" && e.collectors.Alerts {
+		ch <- alertsTotal
+	}
+	// Contacts
+	if e.nagiostatsPath == "" && e.livestatusSocket == "" && e.statusFile == "" && e.collectors.Contacts {
+		ch <- contactsTotal
+		ch <- contactsNotificationsEnabled
+		ch <- contactgroupMembersTotal
+		ch <- contactgroupMembersNotificationsEnabledTotal
+	}
 	// Optional metric
-	ch <- updateAvailable
+	if e.nagiostatsPath == "" && e.checkUpdates {
+		ch <- updateAvailable
+	}
 }
 
-func (e *Exporter) TestNagiosConnectivity(sslVerify bool, nagiosAPITimeout time.Duration) float64 {
+func (e *Exporter) TestNagiosConnectivity(nagiosAPITimeout time.Duration) float64 {
+	nagiosStatus, _ := e.querySystemStatus(nagiosAPITimeout)
+	return nagiosStatus
+}
+
+// querySystemStatus also returns whether system/status could be queried at all, as Nagios may be reachable but not running
+func (e *Exporter) querySystemStatus(nagiosAPITimeout time.Duration) (float64, bool) {
 
-	systemStatusURL := e.nagiosEndpoint + systemstatusAPI + "?apikey=" + e.nagiosAPIKey
+	systemStatusURL := e.apiURL(systemstatusAPI)
 
-	body := QueryAPIs(systemStatusURL, sslVerify, nagiosAPITimeout)
+	body, err := e.QueryAPIsCached(systemStatusURL, nagiosAPITimeout)
 	log.Debug("Queried API: ", systemstatusAPI)
 
 	systemStatusObject := systemStatus{}
 
-	jsonErr := json.Unmarshal(body, &systemStatusObject)
-	if jsonErr != nil {
-		return 0
+	if !e.unmarshalAPIResponse(apiResponse{body: body, err: err}, systemstatusAPI, &systemStatusObject) {
+		return 0, false
 	}
 
-	return systemStatusObject.Running
+	return systemStatusObject.Running, true
 }
 
 func (e *Exporter) TestNagiosstatsBinary(nagiostatsPath string, nagiosconfigPath string) float64 {
@@ -280,17 +759,92 @@ func (e *Exporter) TestNagiosstatsBinary(nagiostatsPath string, nagiosconfigPath
 	err := cmd.Run()
 
 	if err != nil {
-		log.Fatal(err)
+		log.Warn(err)
 		return 0
 	}
 
 	return 1
 }
 
+// Collect shares the metrics of a scrape already in progress instead of querying Nagios again
+// so a slow Nagios isn't loaded further by scrapes piling up
 func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
+	metrics, _, shared := e.collectGroup.Do("collect", func() (interface{}, error) {
+		collected := make(chan prometheus.Metric)
+		var metrics []prometheus.Metric
+
+		done := make(chan struct{})
+		go func() {
+			for metric := range collected {
+				metrics = append(metrics, metric)
+			}
+			close(done)
+		}()
+
+		e.collect(collected)
+		close(collected)
+		<-done
+
+		return metrics, nil
+	})
+	if shared {
+		log.Debug("Sharing the metrics of a scrape already in progress")
+	}
+
+	for _, metric := range metrics.([]prometheus.Metric) {
+		ch <- metric
+	}
+}
+
+func (e *Exporter) collect(ch chan<- prometheus.Metric) {
 
-	if e.nagiostatsPath == "" {
-		nagiosStatus := e.TestNagiosConnectivity(e.sslVerify, e.nagiosAPITimeout)
+	scrapeStart := time.Now()
+
+	ch <- prometheus.MustNewConstMetric(
+		buildInfo, prometheus.GaugeValue, 1, Version, BuildDate, Commit,
+	)
+
+	ch <- prometheus.MustNewConstMetric(
+		exporterStartTime, prometheus.GaugeValue, float64(startTime.Unix()),
+	)
+
+	// nagiostats, livestatus and status.dat don't read the configuration file
+	if reloadTime := configLastReload.Load(); reloadTime > 0 {
+		ch <- prometheus.MustNewConstMetric(
+			configReloadTime, prometheus.GaugeValue, float64(reloadTime),
+		)
+	}
+
+	if e.livestatusSocket != "" {
+		nagiosStatus, nagiosVersion := e.TestLivestatusConnectivity(e.livestatusSocket, e.nagiosAPITimeout)
+		if nagiosStatus == 0 {
+			log.Warn("Cannot connect to livestatus socket: ", e.livestatusSocket)
+		}
+
+		ch <- prometheus.MustNewConstMetric(
+			up, prometheus.GaugeValue, nagiosStatus,
+		)
+
+		if nagiosStatus == 1 {
+			e.QueryLivestatusAndUpdateMetrics(ch, e.livestatusSocket, e.nagiosAPITimeout, nagiosVersion)
+		}
+	} else if e.statusFile != "" {
+		blocks, err := e.ReadStatusFile(e.statusFile)
+		nagiosStatus := 1.0
+		if err != nil {
+			nagiosStatus = 0
+			log.Warn("Cannot read status file: ", err)
+		}
+
+		ch <- prometheus.MustNewConstMetric(
+			up, prometheus.GaugeValue, nagiosStatus,
+		)
+
+		if nagiosStatus == 1 {
+			e.UpdateStatusFileMetrics(ch, blocks)
+		}
+	} else if e.nagiostatsPath == "" {
+		nagiosStatus, systemStatusOK := e.querySystemStatus(e.nagiosAPITimeout)
 
 		if nagiosStatus == 0 {
 			log.Warn("Cannot connect to Nagios endpoint")
@@ -299,8 +853,9 @@ func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
 		ch <- prometheus.MustNewConstMetric(
 			up, prometheus.GaugeValue, nagiosStatus,
 		)
+		emitAPIUp(ch, systemstatusAPI, systemStatusOK)
 
-		e.QueryAPIsAndUpdateMetrics(ch, e.sslVerify, e.nagiosAPITimeout, e.checkUpdates)
+		e.QueryAPIsAndUpdateMetrics(ch, e.nagiosAPITimeout, e.checkUpdates)
 	} else {
 		nagiosStatus := e.TestNagiosstatsBinary(e.nagiostatsPath, e.nagiosconfigPath)
 		if nagiosStatus == 0 {
@@ -313,470 +868,1185 @@ func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
 
 		e.QueryNagiostatsAndUpdateMetrics(ch, e.nagiostatsPath, e.nagiosconfigPath)
 	}
+
+	ch <- prometheus.MustNewConstMetric(
+		scrapeDuration, prometheus.GaugeValue, time.Since(scrapeStart).Seconds(),
+	)
+
+	ch <- prometheus.MustNewConstMetric(
+		scrapeErrors, prometheus.CounterValue, float64(e.scrapeErrorCount.Load()),
+	)
+
+	e.apiRequestDuration.Collect(ch)
+}
+
+// CheckConnectivity is why Nagios can't be reached, with whichever of the API, nagiostats, livestatus or status.dat
+// is configured, for --check and /healthz. Unlike a scrape it bypasses the cache and doesn't count towards
+// nagios_scrape_errors_total or nagios_api_request_duration_seconds
+func (e *Exporter) CheckConnectivity(timeout time.Duration) error {
+	switch {
+	case e.livestatusSocket != "":
+		_, err := livestatus.Query(e.livestatusSocket, timeout, "GET status\nColumns: program_version")
+		return err
+	case e.nagiostatsPath != "":
+		return exec.Command(e.nagiostatsPath, "-c", e.nagiosconfigPath).Run()
+	case e.statusFile != "":
+		_, err := e.ReadStatusFile(e.statusFile)
+		return err
+	}
+
+	_, nagiosUsername, nagiosPassword := e.credentials()
+	body, err := QueryAPIs(e.client, e.apiURL(systemstatusAPI), timeout, nagiosUsername, nagiosPassword, e.userAgent, e.requestHeaders())
+	if err != nil {
+		return err
+	}
+
+	systemStatusObject := systemStatus{}
+	if err := parse_api_response.Unmarshal(body, &systemStatusObject); err != nil {
+		return fmt.Errorf("parsing %s: %w", systemstatusAPI, err)
+	}
+	if err := parse_api_response.APIError(body); err != nil {
+		return fmt.Errorf("%s: %w", systemstatusAPI, err)
+	}
+	if systemStatusObject.Running != 1 {
+		return errors.New("Nagios is reachable but not running")
+	}
+
+	return nil
+}
+
+// probes get a fast answer even when Nagios hangs, and checking at most every healthCacheTTL stops
+// frequent readiness probes from hammering Nagios themselves
+const healthTimeout = 2 * time.Second
+const healthCacheTTL = 10 * time.Second
+
+// serves /healthz, 200 when every configured Nagios is reachable and 503 otherwise
+type healthCheck struct {
+	// held during the check so concurrent probes wait for one result instead of all querying Nagios
+	mutex     sync.Mutex
+	exporters []*Exporter
+	checkedAt time.Time
+	healthy   bool
+}
+
+func (h *healthCheck) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mutex.Lock()
+	if time.Since(h.checkedAt) > healthCacheTTL {
+		h.healthy = true
+		for _, e := range h.exporters {
+			if err := e.CheckConnectivity(healthTimeout); err != nil {
+				log.Debug("Health check failed: ", err)
+				h.healthy = false
+				break
+			}
+		}
+		h.checkedAt = time.Now()
+	}
+	healthy := h.healthy
+	h.mutex.Unlock()
+
+	if !healthy {
+		http.Error(w, "not ok", http.StatusServiceUnavailable)
+		return
+	}
+
+	_, err := w.Write([]byte("ok\n"))
+	if err != nil {
+		log.Warn("Failed to write health check response: ", err)
+	}
 }
 
 // NagiosXI only supports submitting an API token as a URL parameter, so we need to scrub the API key from HTTP client errors
 func sanitizeAPIKeyErrors(err error) error {
-	var re = regexp.MustCompile("(apikey=)(.*)")
+	// only up to the end of the parameter, the rest of the error is what explains it
+	var re = regexp.MustCompile(`(apikey=)[^&\s"']*`)
 	sanitizedString := re.ReplaceAllString(err.Error(), "${1}<redactedAPIKey>")
 
 	return errors.New(sanitizedString)
 }
 
-func QueryAPIs(url string, sslVerify bool, nagiosAPITimeout time.Duration) (body []byte) {
+// repeatable --nagios.header flag of `key=value` pairs
+type headerFlag http.Header
+
+func (h headerFlag) String() string {
+	var headers []string
+	for key, values := range h {
+		for _, value := range values {
+			headers = append(headers, key+"="+value)
+		}
+	}
+	return strings.Join(headers, ",")
+}
+
+func (h headerFlag) Set(header string) error {
+	key, value, ok := strings.Cut(header, "=")
+	if !ok || strings.TrimSpace(key) == "" {
+		return fmt.Errorf("expected key=value, got %q", header)
+	}
+	http.Header(h).Add(strings.TrimSpace(key), value)
+	return nil
+}
+
+// an explicit --nagios.proxy-url wins over the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables
+func proxyFunc(proxyURL *url.URL) func(*http.Request) (*url.URL, error) {
+	if proxyURL != nil {
+		return http.ProxyURL(proxyURL)
+	}
+	return http.ProxyFromEnvironment
+}
+
+// --nagios.tls-ca-file implies verifying the Nagios certificate, regardless of --nagios.ssl-verify
+// serverName is verified against the certificate instead of the URL host, e.g when Nagios is scraped by IP
+func NewTLSConfig(sslVerify bool, certFile string, keyFile string, caFile string, serverName string) (*tls.Config, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: !sslVerify, ServerName: serverName}
+
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if caFile != "" {
+		ca, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+
+		rootCAs := x509.NewCertPool()
+		if !rootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificates found in %s", caFile)
+		}
+		tlsConfig.RootCAs = rootCAs
+		tlsConfig.InsecureSkipVerify = false
+	}
+
+	return tlsConfig, nil
+}
+
+// enough idle connections for every API a scrape queries concurrently, the default of 2 would
+// close most of them after each scrape
+const maxIdleConnsPerHost = 16
 
+// built once per exporter rather than per request, so connections to Nagios are kept alive between requests
+// nagiosAPITimeout bounds every request, retries further shorten each attempt's deadline in QueryAPIs
+func newAPIClient(proxyURL *url.URL, tlsConfig *tls.Config, nagiosAPITimeout time.Duration) *http.Client {
 	// https://github.com/prometheus/haproxy_exporter/blob/main/haproxy_exporter.go#L337-L345
-	tr := &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: !sslVerify}}
+	tr := &http.Transport{
+		Proxy:               proxyFunc(proxyURL),
+		TLSClientConfig:     tlsConfig,
+		MaxIdleConnsPerHost: maxIdleConnsPerHost,
+		IdleConnTimeout:     90 * time.Second,
+	}
 
-	client := http.Client{
+	return &http.Client{
 		Timeout:   nagiosAPITimeout,
 		Transport: tr,
 	}
+}
+
+func QueryAPIs(client *http.Client, url string, nagiosAPITimeout time.Duration, username string, password string, userAgent string, headers http.Header) (body []byte, err error) {
+	// the client is shared, so a retry's shorter deadline is set on the request instead
+	ctx, cancel := context.WithTimeout(context.Background(), nagiosAPITimeout)
+	defer cancel()
 
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 
 	if err != nil {
-		log.Warn(sanitizeAPIKeyErrors(err))
+		return nil, sanitizeAPIKeyErrors(err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("User-Agent", "Prometheus")
+	req.Header.Set("User-Agent", userAgent)
+	// set explicitly rather than left to the transport, which stops decompressing once any Accept-Encoding is set
+	// e.g by --nagios.header. servicestatus of large installations compresses very well
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	// --nagios.header is applied last so it can override the headers above
+	for key, values := range headers {
+		req.Header[key] = values
+	}
+
+	if username != "" || password != "" {
+		req.SetBasicAuth(username, password)
+	}
 
 	resp, err := client.Do(req)
 
 	if err != nil {
-		log.Fatal(sanitizeAPIKeyErrors(err))
+		return nil, transientError{sanitizeAPIKeyErrors(err)}
 	}
 
 	if resp.Body != nil {
 		defer resp.Body.Close()
 	} else {
-		log.Fatal("HTTP response body is nil - check API connectivity")
+		return nil, errors.New("HTTP response body is nil - check API connectivity")
 	}
 
-	body, readErr := io.ReadAll(resp.Body)
+	// e.g a 502 from a proxy in front of Nagios while it reloads
+	if resp.StatusCode >= 500 {
+		return nil, transientError{fmt.Errorf("Nagios API returned %s", resp.Status)}
+	}
+	// e.g a bad API key, which no retry will fix. Redirects were already followed, so anything else
+	// like a 204 or 304 has no body to parse either
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("Nagios API returned %s", resp.Status)
+	}
+
+	// the server may still respond uncompressed, e.g when compression isn't enabled for application/json
+	var reader io.Reader = resp.Body
+	if strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		gzipReader, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return nil, sanitizeAPIKeyErrors(err)
+		}
+		defer gzipReader.Close()
+		reader = gzipReader
+	}
+
+	body, readErr := io.ReadAll(reader)
 
 	if readErr != nil {
-		log.Fatal(sanitizeAPIKeyErrors(readErr))
-	}
-
-	return body
-}
-
-func histogramProducer(bucket1, bucket2, bucket3, bucket4, bucket5, bucket6, bucket7, bucket8, bucket9, bucket10, step1, step2, step3, step4, step5, step6, step7, step8, step9, step10, comparisonValue float64) (float64, float64, float64, float64, float64, float64, float64, float64, float64, float64) {
-	// pretty lame as this requires exactly 10 buckets
-	// remember histogram cumulative so every leave off the smallest bucket each time
-
-	switch value := comparisonValue; {
-	case 0.0 <= value && value <= step1:
-		bucket1++
-		bucket2++
-		bucket3++
-		bucket4++
-		bucket5++
-		bucket6++
-		bucket7++
-		bucket8++
-		bucket9++
-		bucket10++
-		// fmt.Println("value is! ", value)
-		// fmt.Println("all buckets between 0.0 and ", step1)
-	case step1 < value && value <= step2:
-		bucket2++
-		bucket3++
-		bucket4++
-		bucket5++
-		bucket6++
-		bucket7++
-		bucket8++
-		bucket9++
-		bucket10++
-	case step2 < value && value <= step3:
-		bucket3++
-		bucket4++
-		bucket5++
-		bucket6++
-		bucket7++
-		bucket8++
-		bucket9++
-		bucket10++
-	case step3 < value && value <= step4:
-		bucket4++
-		bucket5++
-		bucket6++
-		bucket7++
-		bucket8++
-		bucket9++
-		bucket10++
-	case step4 < value && value <= step5:
-		bucket5++
-		bucket6++
-		bucket7++
-		bucket8++
-		bucket9++
-		bucket10++
-	case step5 < value && value <= step6:
-		bucket6++
-		bucket7++
-		bucket8++
-		bucket9++
-		bucket10++
-	case step6 < value && value <= step7:
-		bucket7++
-		bucket8++
-		bucket9++
-		bucket10++
-	case step7 < value && value <= step8:
-		bucket8++
-		bucket9++
-		bucket10++
-	case step8 < value && value <= step9:
-		bucket9++
-		bucket10++
-	case step9 < value && value <= step10:
-		bucket10++
-
-	}
-	return bucket1, bucket2, bucket3, bucket4, bucket5, bucket6, bucket7, bucket8, bucket9, bucket10
-}
-func (e *Exporter) QueryAPIsAndUpdateMetrics(ch chan<- prometheus.Metric, sslVerify bool, nagiosAPITimeout time.Duration, checkUpdates bool) {
-
-	// get system status
-	systeminfoURL := e.nagiosEndpoint + systeminfoAPI + "?apikey=" + e.nagiosAPIKey
-	log.Debug("Queried API: ", systeminfoAPI)
-
-	body := QueryAPIs(systeminfoURL, sslVerify, nagiosAPITimeout)
+		return nil, transientError{sanitizeAPIKeyErrors(readErr)}
+	}
 
-	systemInfoObject := systemInfo{}
-	jsonErr := json.Unmarshal(body, &systemInfoObject)
-	if jsonErr != nil {
-		log.Fatal(jsonErr)
+	// fail here rather than in the JSON parser, before an HTML login page could be cached
+	if err := parse_api_response.CheckContentType(resp.Header.Get("Content-Type"), body); err != nil {
+		return nil, sanitizeAPIKeyErrors(err)
 	}
 
-	ch <- prometheus.MustNewConstMetric(
-		versionInfo, prometheus.GaugeValue, 1, systemInfoObject.Version,
-	)
+	return body, nil
+}
+
+// a QueryAPIs failure that may not happen again, e.g a connection reset or a 5xx while Nagios reloads
+type transientError struct {
+	err error
+}
+
+func (t transientError) Error() string {
+	return t.err.Error()
+}
+
+func (t transientError) Unwrap() error {
+	return t.err
+}
+
+// the wait before the first retry, doubled for every retry after
+const retryBackoff = 100 * time.Millisecond
+
+// retries transient failures up to --nagios.retries times, with every attempt and the waits in between
+// sharing nagiosAPITimeout so retries don't lengthen a scrape beyond it
+func (e *Exporter) queryAPIsWithRetries(url string, nagiosAPITimeout time.Duration, nagiosUsername, nagiosPassword string) ([]byte, error) {
+	deadline := time.Now().Add(nagiosAPITimeout)
+	backoff := retryBackoff
+
+	for attempt := 1; ; attempt++ {
+		body, err := e.timeQueryAPIs(url, time.Until(deadline), nagiosUsername, nagiosPassword)
+
+		var transient transientError
+		if err == nil || attempt > e.retries || !errors.As(err, &transient) || time.Until(deadline) <= backoff {
+			return body, err
+		}
 
-	// optional cmdline flag to expose this metric
-	if checkUpdates {
-		nagiosVersion, err := get_nagios_version.GetLatestNagiosXIVersion(NagiosXIURL)
+		apiPath, _, _ := strings.Cut(url, "?")
+		log.Debug("Retrying ", path.Base(apiPath), " in ", backoff, " after attempt ", attempt, " failed: ", err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// apiURL is the URL of an API like /objects/hoststatus with query parameters like `advanced=1`,
+// plus the API key unless --nagios.auth-mode=header sends it as a header instead
+func (e *Exporter) apiURL(api string, params ...string) string {
+	apiURL := e.nagiosEndpoint + api
+	if e.authMode != "header" {
+		nagiosAPIKey, _, _ := e.credentials()
+		apiURL = addQueryParam(apiURL, "apikey="+nagiosAPIKey)
+	}
+
+	for _, param := range params {
+		apiURL = addQueryParam(apiURL, param)
+	}
+
+	return apiURL
+}
+
+func addQueryParam(url string, param string) string {
+	if strings.Contains(url, "?") {
+		return url + "&" + param
+	}
+	return url + "?" + param
+}
+
+// with --nagios.auth-mode=header the API key is sent as X-API-KEY, --nagios.header can still override it
+func (e *Exporter) requestHeaders() http.Header {
+	if e.authMode != "header" {
+		return e.headers
+	}
+
+	nagiosAPIKey, _, _ := e.credentials()
+	headers := http.Header{"X-Api-Key": {nagiosAPIKey}}
+	for key, values := range e.headers {
+		headers[key] = values
+	}
+	return headers
+}
+
+// observes the duration of every request actually sent to Nagios, cached responses aren't counted
+func (e *Exporter) timeQueryAPIs(url string, nagiosAPITimeout time.Duration, nagiosUsername, nagiosPassword string) ([]byte, error) {
+	requestStart := time.Now()
+	body, err := QueryAPIs(e.client, url, nagiosAPITimeout, nagiosUsername, nagiosPassword, e.userAgent, e.requestHeaders())
+
+	// e.g servicestatus, query parameters like the apikey are left out
+	apiPath, _, _ := strings.Cut(url, "?")
+	e.apiRequestDuration.WithLabelValues(path.Base(apiPath)).Observe(time.Since(requestStart).Seconds())
+
+	return body, err
+}
+
+// QueryAPIsCached serves a response body from memory until --nagios.cache-ttl expires
+// only successful responses are cached so a failing Nagios is retried on the next scrape
+func (e *Exporter) QueryAPIsCached(url string, nagiosAPITimeout time.Duration) ([]byte, error) {
+	_, nagiosUsername, nagiosPassword := e.credentials()
+
+	if e.cacheTTL <= 0 {
+		return e.queryAPIsWithRetries(url, nagiosAPITimeout, nagiosUsername, nagiosPassword)
+	}
+
+	e.cacheMutex.Lock()
+	cached, ok := e.cache[url]
+	e.cacheMutex.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.body, nil
+	}
+
+	body, err, _ := e.cacheGroup.Do(url, func() (interface{}, error) {
+		body, err := e.queryAPIsWithRetries(url, nagiosAPITimeout, nagiosUsername, nagiosPassword)
 		if err != nil {
-			// don't abandon exporter just for version updater issues
-			log.Warn(err)
+			return nil, err
 		}
 
-		updateMetric := CompareNagiosVersions(nagiosVersion, systemInfoObject.Version)
-		ch <- prometheus.MustNewConstMetric(
-			updateAvailable, prometheus.GaugeValue, updateMetric,
-			// updateMetric 0 = no update, updateMetric 1 = update available
-		)
-	} else { // user did not want to compare nagios versions externally so just say there aren't any updates (0)
+		e.cacheMutex.Lock()
+		e.cache[url] = cachedResponse{body: body, expires: time.Now().Add(e.cacheTTL)}
+		e.cacheMutex.Unlock()
+
+		return body, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return body.([]byte), nil
+}
+
+// returns false when Nagios has no time, e.g last_check of a host that was never checked
+func parseNagiosTimestamp(timestamp string) (float64, bool) {
+	t, err := time.ParseInLocation(nagiosTimeLayout, timestamp, time.Local)
+	if err != nil || t.Unix() <= 0 {
+		return 0, false
+	}
+
+	return float64(t.Unix()), true
+}
+
+// emit a per-object timestamp metric, skipping times Nagios doesn't have
+func emitTimestampMetric(ch chan<- prometheus.Metric, desc *prometheus.Desc, timestamp string, labelValues ...string) {
+	if value, ok := parseNagiosTimestamp(timestamp); ok {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value, labelValues...)
+	}
+}
+
+// queryAPIsUncached is for URLs changing every scrape, which would never be served from the cache and only pile up in it
+func (e *Exporter) queryAPIsUncached(url string, nagiosAPITimeout time.Duration) ([]byte, error) {
+	_, nagiosUsername, nagiosPassword := e.credentials()
+	return e.queryAPIsWithRetries(url, nagiosAPITimeout, nagiosUsername, nagiosPassword)
+}
+
+// QueryAPIPages requests an objects API like hoststatus in pages of --nagios.page-size records until its recordcount is reached
+// the records of every page are returned as a single response body, e.g `{"recordcount": 2, "hoststatus": [{...}, {...}]}`
+func (e *Exporter) QueryAPIPages(url string, api string, objects string, nagiosAPITimeout time.Duration) ([]byte, error) {
+	return e.queryAPIPages(e.QueryAPIsCached, e.pageSize, url, api, objects, nagiosAPITimeout)
+}
+
+// queryAPIPages is QueryAPIPages with the query of every page and the page size left to the caller
+func (e *Exporter) queryAPIPages(query func(url string, nagiosAPITimeout time.Duration) ([]byte, error), pageSize int, url string, api string, objects string, nagiosAPITimeout time.Duration) ([]byte, error) {
+	var records []json.RawMessage
+	var recordcount float64
+
+	for offset := 0; ; offset += pageSize {
+		// records=<amount>:<starting record>
+		body, err := query(addQueryParam(url, "records="+strconv.Itoa(pageSize)+":"+strconv.Itoa(offset)), nagiosAPITimeout)
+		if err != nil {
+			return nil, err
+		}
+		log.Debug("Queried API: ", api, " from record ", offset)
+
+		page := map[string]json.RawMessage{}
+		if err := parse_api_response.Unmarshal(body, &page); err != nil {
+			return nil, err
+		}
+		if err := parse_api_response.APIError(body); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(page["recordcount"], &recordcount); err != nil {
+			return nil, fmt.Errorf("invalid recordcount: %w", err)
+		}
+
+		var pageRecords []json.RawMessage
+		// a page past the last record may leave out the objects entirely
+		if _, ok := page[objects]; ok {
+			if err := json.Unmarshal(page[objects], &pageRecords); err != nil {
+				return nil, err
+			}
+		}
+		records = append(records, pageRecords...)
+
+		// a short page is the last one, even if the objects changed between pages and recordcount wasn't reached
+		if len(pageRecords) < pageSize || float64(len(records)) >= recordcount {
+			break
+		}
+	}
+
+	if float64(len(records)) != recordcount {
+		log.Warn("Queried ", len(records), " records of API ", api, " but its recordcount is ", recordcount)
+	}
+
+	return json.Marshal(map[string]interface{}{
+		"recordcount": recordcount,
+		objects:       records,
+	})
+}
+
+type apiResponse struct {
+	body []byte
+	err  error
+}
+
+// unmarshal an API response, counting a failed query or unparsable body as a scrape error
+// returns false when the metrics from this endpoint should be skipped
+func (e *Exporter) unmarshalAPIResponse(resp apiResponse, api string, v interface{}) bool {
+	if resp.err != nil {
+		e.scrapeErrorCount.Add(1)
+		log.Warn("Failed to query API ", api, ": ", resp.err)
+		return false
+	}
+
+	if err := parse_api_response.Unmarshal(resp.body, v); err != nil {
+		e.scrapeErrorCount.Add(1)
+		log.Warn("Failed to parse API ", api, ": ", err)
+		return false
+	}
+
+	// otherwise every field of v is left empty and reported as zeroes
+	if err := parse_api_response.APIError(resp.body); err != nil {
+		e.scrapeErrorCount.Add(1)
+		log.Warn("Failed to query API ", api, ": ", sanitizeAPIKeyErrors(err))
+		return false
+	}
+
+	return true
+}
+
+// like unmarshalAPIResponse, also exposing whether the endpoint could be queried and parsed as nagios_api_up
+func (e *Exporter) collectAPIResponse(ch chan<- prometheus.Metric, resp apiResponse, api string, v interface{}) bool {
+	ok := e.unmarshalAPIResponse(resp, api, v)
+	emitAPIUp(ch, api, ok)
+	return ok
+}
+
+func emitAPIUp(ch chan<- prometheus.Metric, api string, ok bool) {
+	var value float64
+	if ok {
+		value = 1
+	}
+	ch <- prometheus.MustNewConstMetric(apiUp, prometheus.GaugeValue, value, path.Base(api))
+}
+
+// every count is taken from the records parsed, so a partial payload is otherwise invisible
+func emitRecordcountMismatch(ch chan<- prometheus.Metric, api string, recordcount float64, records int) {
+	ch <- prometheus.MustNewConstMetric(apiRecordcountMismatch, prometheus.GaugeValue, recordcount-float64(records), path.Base(api))
+}
+
+// upper bounds of host_checks_execution and service_checks_execution, unlike the latency ones they aren't configurable
+var executionBuckets = []float64{0.01, 0.05, 0.1, 0.3, 0.5, 0.7, 1.0, 1.5, 2.0, 2.5}
+
+// every bucket starts at 0 so empty buckets are still exposed
+func newBuckets(upperBounds []float64) map[float64]uint64 {
+	buckets := make(map[float64]uint64, len(upperBounds))
+	for _, upperBound := range upperBounds {
+		buckets[upperBound] = 0
+	}
+	return buckets
+}
+
+// histogram buckets are cumulative, so a value counts towards every bucket with a greater or equal upper bound
+func observeBuckets(buckets map[float64]uint64, value float64) {
+	// latencies and execution times below 0 are bogus, they're left out of the buckets but not the sum and count
+	if value < 0 {
+		return
+	}
+	for upperBound := range buckets {
+		if value <= upperBound {
+			buckets[upperBound]++
+		}
+	}
+}
+
+// parse a comma separated list of increasing bucket upper bounds like `0.1,1,10`
+func ParseBuckets(buckets string) ([]float64, error) {
+	var upperBounds []float64
+	for _, bucket := range strings.Split(buckets, ",") {
+		upperBound, err := strconv.ParseFloat(strings.TrimSpace(bucket), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bucket %q: %w", bucket, err)
+		}
+		if len(upperBounds) > 0 && upperBound <= upperBounds[len(upperBounds)-1] {
+			return nil, fmt.Errorf("buckets must be in increasing order, %v is not greater than %v", upperBound, upperBounds[len(upperBounds)-1])
+		}
+		upperBounds = append(upperBounds, upperBound)
+	}
+	return upperBounds, nil
+}
+func (e *Exporter) QueryAPIsAndUpdateMetrics(ch chan<- prometheus.Metric, nagiosAPITimeout time.Duration, checkUpdates bool) {
+
+	systeminfoURL := e.apiURL(systeminfoAPI)
+	hoststatusURL := e.apiURL(hoststatusAPI)
+	servicestatusURL := e.apiURL(servicestatusAPI)
+	systemStatusDetailURL := e.apiURL(systemstatusDetailAPI)
+	// we also need to tack on the optional parameter of `advanced` to get privilege information
+	systemUserURL := e.apiURL(systemuserAPI, "advanced=1")
+	hostgroupMembersURL := e.apiURL(hostgroupmembersAPI)
+	servicegroupMembersURL := e.apiURL(servicegroupmembersAPI)
+	downtimeURL := e.apiURL(downtimeAPI)
+	commentURL := e.apiURL(commentAPI)
+	contactURL := e.apiURL(contactAPI)
+	contactgroupMembersURL := e.apiURL(contactgroupmembersAPI)
+
+	// the state history is queried from where the last successful scrape left off, less alertsLateMargin for
+	// state changes written late, e.g by a lagging NDO. Those in the overlap already counted are skipped
+	alertsUntil := time.Now().Unix()
+	e.alertsMutex.Lock()
+	alertsStart := e.alertsSince - int64(alertsLateMargin.Seconds())
+	if e.alertsSince == 0 {
+		alertsStart = alertsUntil - int64(e.alertsLookback.Seconds())
+	}
+	statehistoryURL := e.apiURL(statehistoryAPI, "starttime="+strconv.FormatInt(alertsStart, 10), "endtime="+strconv.FormatInt(alertsUntil, 10))
+	e.alertsMutex.Unlock()
+
+	// none of the APIs depend on each other, so query them concurrently instead of waiting on each round trip
+	// every request is still bound by nagiosAPITimeout individually
+	var systemInfoResp, hostStatusResp, serviceStatusResp, systemStatusDetailResp, systemUserResp, hostgroupMembersResp, servicegroupMembersResp, downtimeResp, commentResp, contactResp, contactgroupMembersResp, statehistoryResp apiResponse
+	var wg sync.WaitGroup
+
+	queryAPI := func(resp *apiResponse, url string, api string) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp.body, resp.err = e.QueryAPIsCached(url, nagiosAPITimeout)
+			log.Debug("Queried API: ", api)
+		}()
+	}
+
+	// hoststatus and servicestatus grow with the installation, so they're the ones paginated
+	queryAPIPages := func(resp *apiResponse, url string, api string, objects string) {
+		if e.pageSize <= 0 {
+			queryAPI(resp, url, api)
+			return
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp.body, resp.err = e.QueryAPIPages(url, api, objects, nagiosAPITimeout)
+		}()
+	}
+
+	queryAPI(&systemInfoResp, systeminfoURL, systeminfoAPI)
+	if e.collectors.HostStatus {
+		queryAPIPages(&hostStatusResp, hoststatusURL, hoststatusAPI, "hoststatus")
+	}
+	if e.collectors.ServiceStatus {
+		queryAPIPages(&serviceStatusResp, servicestatusURL, servicestatusAPI, "servicestatus")
+	}
+	if e.collectors.StatusDetail {
+		queryAPI(&systemStatusDetailResp, systemStatusDetailURL, systemstatusDetailAPI)
+	}
+	if e.collectors.Users {
+		queryAPI(&systemUserResp, systemUserURL, systemuserAPI)
+	}
+	if e.collectors.Groups {
+		queryAPI(&hostgroupMembersResp, hostgroupMembersURL, hostgroupmembersAPI)
+		queryAPI(&servicegroupMembersResp, servicegroupMembersURL, servicegroupmembersAPI)
+	}
+	if e.collectors.Downtime {
+		queryAPI(&downtimeResp, downtimeURL, downtimeAPI)
+	}
+	if e.collectors.Comments {
+		queryAPI(&commentResp, commentURL, commentAPI)
+	}
+	if e.collectors.Contacts {
+		queryAPI(&contactResp, contactURL, contactAPI)
+		queryAPI(&contactgroupMembersResp, contactgroupMembersURL, contactgroupmembersAPI)
+	}
+	if e.collectors.Alerts {
+		// starttime and endtime change every scrape, so the state history isn't cached. It's always paginated,
+		// as the first scrape's lookback of a notification storm can be larger than hoststatus
+		pageSize := e.pageSize
+		if pageSize <= 0 {
+			pageSize = statehistoryPageSize
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			statehistoryResp.body, statehistoryResp.err = e.queryAPIPages(e.queryAPIsUncached, pageSize, statehistoryURL, statehistoryAPI, "stateentry", nagiosAPITimeout)
+		}()
+	}
+
+	wg.Wait()
+
+	// a failing endpoint only skips its own metrics, the rest of the scrape carries on
+	// system info
+	systemInfoObject := systemInfo{}
+	if e.collectAPIResponse(ch, systemInfoResp, systeminfoAPI, &systemInfoObject) {
 		ch <- prometheus.MustNewConstMetric(
-			updateAvailable, prometheus.GaugeValue, 0,
+			versionInfo, prometheus.GaugeValue, 1, systemInfoObject.Version,
 		)
+
+		// optional cmdline flag to expose this metric
+		if checkUpdates {
+			e.UpdateVersionMetric(ch, systemInfoObject.Version)
+		}
 	}
 
 	// host status
-	hoststatusURL := e.nagiosEndpoint + hoststatusAPI + "?apikey=" + e.nagiosAPIKey
-
-	body = QueryAPIs(hoststatusURL, sslVerify, nagiosAPITimeout)
-	log.Debug("Queried API: ", systeminfoAPI)
-
 	hostStatusObject := hostStatus{}
-
-	jsonErr = json.Unmarshal(body, &hostStatusObject)
-	if jsonErr != nil {
-		log.Fatal(jsonErr)
+	hostStatusOK := e.collectors.HostStatus && e.collectAPIResponse(ch, hostStatusResp, hoststatusAPI, &hostStatusObject)
+	if hostStatusOK {
+		emitRecordcountMismatch(ch, hoststatusAPI, hostStatusObject.Recordcount, len(hostStatusObject.Hoststatus))
 	}
 
-	var hostsCount, hostsActiveCheckCount, hostsPassiveCheckCount, hostsUpCount, hostsDownCount, hostsUnreachableCount, hostsFlapCount, hostsDowntimeCount, hostsProblemsAcknowledgedCount float64
+	var hostCounts status_counts.HostCounts
 
 	// not sure if these variable names are awful or acceptable
-	var hostsActiveCheckLatencySum, hostsActiveCheckLatencyHundredthSecond, hostsActiveCheckLatencyTenthSecond,
-		hostsActiveCheckLatencyHalfSecond, hostsActiveCheckLatency1s, hostsActiveCheckLatency3s, hostsActiveCheckLatency5s, hostsActiveCheckLatency7s, hostsActiveCheckLatency10s, hostsActiveCheckLatency12s, hostsActiveCheckLatency15s float64
+	var hostsActiveCheckLatencySum float64
+	hostsActiveCheckLatencyBuckets := newBuckets(e.latencyBuckets)
 
-	var hostsActiveCheckExecutionSum, hostsActiveCheckExecutionHundredthSecond, hostsActiveCheckExecutionFifthHundredthSecond,
-		hostsActiveCheckExecutionTenthSecond, hostsActiveCheckExecutionThirdSecond, hostsActiveCheckExecutionHalfSecond, hostsActiveCheckExecutionSeventhSecond, hostsActiveCheckExecution1s, hostsActiveCheckExecution1Halfs, hostsActiveCheckExecution2s, hostsActiveCheckExecution2Halfs float64
+	var hostsActiveCheckExecutionSum float64
+	hostsActiveCheckExecutionBuckets := newBuckets(executionBuckets)
 
 	// iterate through nested json
 	for _, v := range hostStatusObject.Hoststatus {
 
-		// for every host
-		hostsCount++
-
-		if v.CheckType == 0 {
-			hostsActiveCheckCount++
+		hostCounts.Add(v.Host)
 
+		if status_counts.CheckType(v.CheckType) == "active" {
 			// beware all ye who enter here and try to understand this
 
-			hostsActiveCheckLatencyHundredthSecond, hostsActiveCheckLatencyTenthSecond,
-				hostsActiveCheckLatencyHalfSecond, hostsActiveCheckLatency1s, hostsActiveCheckLatency3s, hostsActiveCheckLatency5s, hostsActiveCheckLatency7s, hostsActiveCheckLatency10s, hostsActiveCheckLatency12s, hostsActiveCheckLatency15s = histogramProducer(hostsActiveCheckLatencyHundredthSecond, hostsActiveCheckLatencyTenthSecond,
-				hostsActiveCheckLatencyHalfSecond, hostsActiveCheckLatency1s, hostsActiveCheckLatency3s, hostsActiveCheckLatency5s, hostsActiveCheckLatency7s, hostsActiveCheckLatency10s, hostsActiveCheckLatency12s, hostsActiveCheckLatency15s, 0.01, 0.1, 0.5, 1.0, 3.0, 5.0, 7.0, 10.0, 12.5, 15.0, v.Latency)
+			observeBuckets(hostsActiveCheckLatencyBuckets, v.Latency)
 
-			hostsActiveCheckExecutionHundredthSecond, hostsActiveCheckExecutionFifthHundredthSecond,
-				hostsActiveCheckExecutionTenthSecond, hostsActiveCheckExecutionThirdSecond, hostsActiveCheckExecutionHalfSecond, hostsActiveCheckExecutionSeventhSecond, hostsActiveCheckExecution1s, hostsActiveCheckExecution1Halfs, hostsActiveCheckExecution2s, hostsActiveCheckExecution2Halfs = histogramProducer(hostsActiveCheckExecutionHundredthSecond, hostsActiveCheckExecutionFifthHundredthSecond,
-				hostsActiveCheckExecutionTenthSecond, hostsActiveCheckExecutionThirdSecond, hostsActiveCheckExecutionHalfSecond, hostsActiveCheckExecutionSeventhSecond, hostsActiveCheckExecution1s, hostsActiveCheckExecution1Halfs, hostsActiveCheckExecution2s, hostsActiveCheckExecution2Halfs, 0.01, 0.05, 0.1, 0.3, 0.5, 0.7, 1.0, 1.5, 2.0, 2.5, v.ExecutionTime)
+			observeBuckets(hostsActiveCheckExecutionBuckets, v.ExecutionTime)
 
 			hostsActiveCheckLatencySum += v.Latency
 			hostsActiveCheckExecutionSum += v.ExecutionTime
 
-		} else {
-			hostsPassiveCheckCount++
-			// remember there is no service check execution time/latency, hence lack of histogram here
 		}
-
-		switch currentstate := v.CurrentState; currentstate {
-		case 0:
-			hostsUpCount++
-		case 1:
-			hostsDownCount++
-		case 2:
-			hostsUnreachableCount++
+		// remember there is no passive check execution time/latency, hence lack of histogram here
+
+		// optional cmdline flag as these are series per host
+		if e.perHost {
+			emitTimestampMetric(ch, hostLastCheck, v.LastCheck, v.HostName)
+			emitTimestampMetric(ch, hostLastStateChange, v.LastStateChange, v.HostName)
+
+			ch <- prometheus.MustNewConstMetric(
+				hostNotificationsEnabled, prometheus.GaugeValue, v.NotificationsEnabled, v.HostName,
+			)
+			ch <- prometheus.MustNewConstMetric(
+				hostActiveChecksEnabled, prometheus.GaugeValue, v.ActiveChecksEnabled, v.HostName,
+			)
+			ch <- prometheus.MustNewConstMetric(
+				hostCurrentAttempt, prometheus.GaugeValue, v.CurrentAttempt, v.HostName,
+			)
+			ch <- prometheus.MustNewConstMetric(
+				hostMaxAttempts, prometheus.GaugeValue, v.MaxAttempts, v.HostName,
+			)
 		}
 
-		if v.IsFlapping == 1 {
-			hostsFlapCount++
+	}
+
+	if hostStatusOK {
+		e.UpdateHostProblemMetrics(ch, hostCounts.AcknowledgedUp, hostCounts.AcknowledgedDown, hostCounts.AcknowledgedUnreachable, hostCounts.HardUp, hostCounts.HardDown, hostCounts.HardUnreachable,
+			hostCounts.NotificationsDisabled, hostCounts.ChecksDisabled, hostCounts.Retrying)
+
+		ch <- prometheus.MustNewConstHistogram(
+			hostsCheckLatency, uint64(hostCounts.Active), hostsActiveCheckLatencySum, hostsActiveCheckLatencyBuckets,
+			"active", "latency",
+		)
+
+		ch <- prometheus.MustNewConstHistogram(
+			hostsCheckExecution, uint64(hostCounts.Active), hostsActiveCheckExecutionSum, hostsActiveCheckExecutionBuckets,
+			"active", "execution",
+		)
+	}
+
+	// service status
+	serviceStatusObject := serviceStatus{}
+	serviceStatusOK := e.collectors.ServiceStatus && e.collectAPIResponse(ch, serviceStatusResp, servicestatusAPI, &serviceStatusObject)
+	if serviceStatusOK {
+		emitRecordcountMismatch(ch, servicestatusAPI, serviceStatusObject.Recordcount, len(serviceStatusObject.Servicestatus))
+	}
+
+	var serviceCounts status_counts.ServiceCounts
+
+	var servicesActiveCheckLatencySum float64
+	servicesActiveCheckLatencyBuckets := newBuckets(e.latencyBuckets)
+
+	var servicesActiveCheckExecutionSum float64
+	servicesActiveCheckExecutionBuckets := newBuckets(executionBuckets)
+
+	for _, v := range serviceStatusObject.Servicestatus {
+
+		serviceCounts.Add(v.Service)
+
+		if status_counts.CheckType(v.CheckType) == "active" {
+			observeBuckets(servicesActiveCheckLatencyBuckets, v.Latency)
+
+			observeBuckets(servicesActiveCheckExecutionBuckets, v.ExecutionTime)
+
+			servicesActiveCheckLatencySum += v.Latency
+			servicesActiveCheckExecutionSum += v.ExecutionTime
 		}
 
-		if v.ScheduledDowntimeDepth == 1 {
-			hostsDowntimeCount++
+		serviceStateLabel := status_counts.ServiceState(v.CurrentState)
+
+		// optional cmdline flag as this is one or more series per service
+		if e.perService {
+			ch <- prometheus.MustNewConstMetric(
+				serviceState, prometheus.GaugeValue, 1, v.HostName, v.ServiceDescription, serviceStateLabel,
+			)
+
+			if v.IsFlapping == 1 {
+				ch <- prometheus.MustNewConstMetric(
+					serviceState, prometheus.GaugeValue, 1, v.HostName, v.ServiceDescription, "flapping",
+				)
+			}
+
+			if v.ProblemHasBeenAcknowledged == 1 {
+				ch <- prometheus.MustNewConstMetric(
+					serviceState, prometheus.GaugeValue, 1, v.HostName, v.ServiceDescription, "acknowledged",
+				)
+			}
+
+			emitTimestampMetric(ch, serviceLastCheck, v.LastCheck, v.HostName, v.ServiceDescription)
+			emitTimestampMetric(ch, serviceLastStateChange, v.LastStateChange, v.HostName, v.ServiceDescription)
+
+			ch <- prometheus.MustNewConstMetric(
+				serviceNotificationsEnabled, prometheus.GaugeValue, v.NotificationsEnabled, v.HostName, v.ServiceDescription,
+			)
+			ch <- prometheus.MustNewConstMetric(
+				serviceActiveChecksEnabled, prometheus.GaugeValue, v.ActiveChecksEnabled, v.HostName, v.ServiceDescription,
+			)
+			ch <- prometheus.MustNewConstMetric(
+				serviceCurrentAttempt, prometheus.GaugeValue, v.CurrentAttempt, v.HostName, v.ServiceDescription,
+			)
+			ch <- prometheus.MustNewConstMetric(
+				serviceMaxAttempts, prometheus.GaugeValue, v.MaxAttempts, v.HostName, v.ServiceDescription,
+			)
 		}
 
-		if v.ProblemHasBeenAcknowledged == 1 {
-			hostsProblemsAcknowledgedCount++
+		// optional cmdline flag as this is a series per perfdata label of every service
+		if e.perfdata && v.Perfdata != "" {
+			perfdata, err := parse_perfdata.ParsePerfdata(v.Perfdata)
+			if err != nil {
+				// plugins output all sorts, don't abandon the scrape just for one service
+				log.Debug("Skipping perfdata of ", v.HostName, "/", v.ServiceDescription, ": ", err)
+			}
+
+			// duplicate series would fail the whole scrape
+			seenLabels := make(map[string]bool, len(perfdata))
+			for _, p := range perfdata {
+				if seenLabels[p.Label] {
+					continue
+				}
+				seenLabels[p.Label] = true
+
+				ch <- prometheus.MustNewConstMetric(
+					servicePerfdata, prometheus.GaugeValue, p.Value, v.HostName, v.ServiceDescription, p.Label, p.Unit,
+				)
+			}
 		}
+	}
 
+	if serviceStatusOK {
+		e.UpdateServiceProblemMetrics(ch, serviceCounts.AcknowledgedOk, serviceCounts.AcknowledgedWarn, serviceCounts.AcknowledgedCritical, serviceCounts.AcknowledgedUnknown,
+			serviceCounts.HardOk, serviceCounts.HardWarn, serviceCounts.HardCritical, serviceCounts.HardUnknown, serviceCounts.NotificationsDisabled, serviceCounts.ChecksDisabled,
+			serviceCounts.Scheduled, serviceCounts.Retrying)
+
+		ch <- prometheus.MustNewConstHistogram(
+			servicesCheckLatency, uint64(serviceCounts.Active), servicesActiveCheckLatencySum, servicesActiveCheckLatencyBuckets,
+			"active", "latency",
+		)
+
+		ch <- prometheus.MustNewConstHistogram(
+			servicesCheckExecution, uint64(serviceCounts.Active), servicesActiveCheckExecutionSum, servicesActiveCheckExecutionBuckets,
+			"active", "execution",
+		)
 	}
 
-	ch <- prometheus.MustNewConstMetric(
-		hostsProblemsAcknowledged, prometheus.GaugeValue, hostsProblemsAcknowledgedCount,
-	)
+	// system status
+	systemStatusDetailObject := systemStatusDetail{}
+	systemStatusDetailOK := e.collectors.StatusDetail && e.collectAPIResponse(ch, systemStatusDetailResp, systemstatusDetailAPI, &systemStatusDetailObject)
 
-	ch <- prometheus.MustNewConstHistogram(
-		hostsCheckLatency, uint64(hostsActiveCheckCount), hostsActiveCheckLatencySum, map[float64]uint64{
-			0.01: uint64(hostsActiveCheckLatencyHundredthSecond),
-			0.1:  uint64(hostsActiveCheckLatencyTenthSecond),
-			0.5:  uint64(hostsActiveCheckLatencyHalfSecond),
-			1.0:  uint64(hostsActiveCheckLatency1s),
-			3.0:  uint64(hostsActiveCheckLatency3s),
-			5.0:  uint64(hostsActiveCheckLatency5s),
-			7.0:  uint64(hostsActiveCheckLatency7s),
-			10.0: uint64(hostsActiveCheckLatency10s),
-			12.5: uint64(hostsActiveCheckLatency12s),
-			15.0: uint64(hostsActiveCheckLatency15s)},
-		"active", "latency",
-	)
+	// user information
+	userStatusObject := userStatus{}
+	if e.collectors.Users && e.collectAPIResponse(ch, systemUserResp, systemuserAPI, &userStatusObject) {
+		var usersAdminCount, usersRegularCount, usersEnabledCount, usersDisabledCount float64
 
-	ch <- prometheus.MustNewConstHistogram(
-		hostsCheckExecution, uint64(hostsActiveCheckCount), hostsActiveCheckExecutionSum, map[float64]uint64{
-			0.01: uint64(hostsActiveCheckExecutionHundredthSecond),
-			0.05: uint64(hostsActiveCheckExecutionFifthHundredthSecond),
-			0.1:  uint64(hostsActiveCheckExecutionTenthSecond),
-			0.3:  uint64(hostsActiveCheckExecutionThirdSecond),
-			0.5:  uint64(hostsActiveCheckExecutionHalfSecond),
-			0.7:  uint64(hostsActiveCheckExecutionSeventhSecond),
-			1.0:  uint64(hostsActiveCheckExecution1s),
-			1.5:  uint64(hostsActiveCheckExecution1Halfs),
-			2.0:  uint64(hostsActiveCheckExecution2s),
-			2.5:  uint64(hostsActiveCheckExecution2Halfs)},
-		"active", "execution",
-	)
+		ch <- prometheus.MustNewConstMetric(
+			usersTotal, prometheus.GaugeValue, userStatusObject.Recordcount,
+		)
 
-	// service status
-	servicestatusURL := e.nagiosEndpoint + servicestatusAPI + "?apikey=" + e.nagiosAPIKey
+		for _, v := range userStatusObject.Userstatus {
 
-	body = QueryAPIs(servicestatusURL, sslVerify, nagiosAPITimeout)
-	log.Debug("Queried API: ", servicestatusAPI)
+			if v.Admin == 1 {
+				usersAdminCount++
+			} else {
+				usersRegularCount++
+			}
 
-	serviceStatusObject := serviceStatus{}
+			if v.Enabled == 1 {
+				usersEnabledCount++
+			} else {
+				usersDisabledCount++
+			}
+		}
+
+		ch <- prometheus.MustNewConstMetric(
+			usersStatus, prometheus.GaugeValue, usersEnabledCount, "enabled",
+		)
+
+		ch <- prometheus.MustNewConstMetric(
+			usersStatus, prometheus.GaugeValue, usersDisabledCount, "disabled",
+		)
+
+		ch <- prometheus.MustNewConstMetric(
+			usersPrivileges, prometheus.GaugeValue, usersAdminCount, "admin",
+		)
 
-	jsonErr = json.Unmarshal(body, &serviceStatusObject)
-	if jsonErr != nil {
-		log.Fatal(jsonErr)
+		ch <- prometheus.MustNewConstMetric(
+			usersPrivileges, prometheus.GaugeValue, usersRegularCount, "user",
+		)
 	}
 
-	var servicesCount, servicesScheduledCount, servicesActiveCheckCount,
-		servicesPassiveCheckCount, servicesOkCount, servicesWarnCount, servicesCriticalCount,
-		servicesUnknownCount, servicesFlapCount, servicesDowntimeCount, servicesProblemsAcknowledgedCount float64
+	// group membership
+	hostgroupMembersObject := hostgroupMembers{}
+	if e.collectors.Groups && e.collectAPIResponse(ch, hostgroupMembersResp, hostgroupmembersAPI, &hostgroupMembersObject) {
+		for _, v := range hostgroupMembersObject.Hostgroup {
+			ch <- prometheus.MustNewConstMetric(
+				hostgroupMembersTotal, prometheus.GaugeValue, float64(len(v.Members.Host)), v.HostgroupName,
+			)
+		}
+	}
 
-	var servicesActiveCheckLatencySum, servicesActiveCheckLatencyHundredthSecond, servicesActiveCheckLatencyTenthSecond,
-		servicesActiveCheckLatencyHalfSecond, servicesActiveCheckLatency1s, servicesActiveCheckLatency3s, servicesActiveCheckLatency5s, servicesActiveCheckLatency7s, servicesActiveCheckLatency10s, servicesActiveCheckLatency12s, servicesActiveCheckLatency15s float64
+	servicegroupMembersObject := servicegroupMembers{}
+	if e.collectors.Groups && e.collectAPIResponse(ch, servicegroupMembersResp, servicegroupmembersAPI, &servicegroupMembersObject) {
+		for _, v := range servicegroupMembersObject.Servicegroup {
+			ch <- prometheus.MustNewConstMetric(
+				servicegroupMembersTotal, prometheus.GaugeValue, float64(len(v.Members.Service)), v.ServicegroupName,
+			)
+		}
+	}
 
-	var servicesActiveCheckExecutionSum, servicesActiveCheckExecutionHundredthSecond, servicesActiveCheckExecutionFifthHundredthSecond,
-		servicesActiveCheckExecutionTenthSecond, servicesActiveCheckExecutionThirdSecond, servicesActiveCheckExecutionHalfSecond, servicesActiveCheckExecutionSeventhSecond, servicesActiveCheckExecution1s, servicesActiveCheckExecution1Halfs, servicesActiveCheckExecution2s, servicesActiveCheckExecution2Halfs float64
+	downtimeObject := scheduledDowntime{}
+	if e.collectors.Downtime && e.collectAPIResponse(ch, downtimeResp, downtimeAPI, &downtimeObject) {
+		var hostDowntimesActive, hostDowntimesScheduled, serviceDowntimesActive, serviceDowntimesScheduled float64
+
+		for _, v := range downtimeObject.Scheduleddowntime {
+			switch {
+			case v.DowntimeType == 2 && v.WasStarted == 1:
+				hostDowntimesActive++
+			case v.DowntimeType == 2:
+				hostDowntimesScheduled++
+			case v.DowntimeType == 1 && v.WasStarted == 1:
+				serviceDowntimesActive++
+			case v.DowntimeType == 1:
+				serviceDowntimesScheduled++
+			}
+		}
 
-	for _, v := range serviceStatusObject.Servicestatus {
+		ch <- prometheus.MustNewConstMetric(
+			downtimesTotal, prometheus.GaugeValue, hostDowntimesActive, "host", "active",
+		)
+		ch <- prometheus.MustNewConstMetric(
+			downtimesTotal, prometheus.GaugeValue, hostDowntimesScheduled, "host", "scheduled",
+		)
+		ch <- prometheus.MustNewConstMetric(
+			downtimesTotal, prometheus.GaugeValue, serviceDowntimesActive, "service", "active",
+		)
+		ch <- prometheus.MustNewConstMetric(
+			downtimesTotal, prometheus.GaugeValue, serviceDowntimesScheduled, "service", "scheduled",
+		)
+	}
 
-		servicesCount++
+	commentObject := comments{}
+	if e.collectors.Comments && e.collectAPIResponse(ch, commentResp, commentAPI, &commentObject) {
+		var hostCommentsCount, serviceCommentsCount float64
+		// persistent acknowledgement comments outlive re-acknowledgements, keep the oldest so label sets stay unique
+		acknowledgedSince := map[[4]string]float64{}
+
+		for _, v := range commentObject.Comment {
+			commentType := "host"
+			if v.CommentType == 2 {
+				commentType = "service"
+				serviceCommentsCount++
+			} else {
+				hostCommentsCount++
+			}
+
+			if v.EntryType != 4 {
+				continue
+			}
+			// entry_time is in the Nagios server's timezone, like the other timestamps
+			if entryTime, ok := parseNagiosTimestamp(v.EntryTime); ok {
+				labels := [4]string{commentType, string(v.HostName), string(v.ServiceDescription), string(v.AuthorName)}
+				if since, seen := acknowledgedSince[labels]; !seen || entryTime < since {
+					acknowledgedSince[labels] = entryTime
+				}
+			}
+		}
 
-		if v.ShouldBeScheduled == 0 {
-			servicesScheduledCount++
+		now := float64(time.Now().Unix())
+		for labels, since := range acknowledgedSince {
+			ch <- prometheus.MustNewConstMetric(
+				acknowledgementAge, prometheus.GaugeValue, now-since, labels[:]...,
+			)
 		}
 
-		if v.CheckType == 0 {
-			servicesActiveCheckCount++
+		ch <- prometheus.MustNewConstMetric(
+			commentsTotal, prometheus.GaugeValue, hostCommentsCount, "host",
+		)
+		ch <- prometheus.MustNewConstMetric(
+			commentsTotal, prometheus.GaugeValue, serviceCommentsCount, "service",
+		)
+	}
 
-			servicesActiveCheckLatencyHundredthSecond, servicesActiveCheckLatencyTenthSecond,
-				servicesActiveCheckLatencyHalfSecond, servicesActiveCheckLatency1s, servicesActiveCheckLatency3s, servicesActiveCheckLatency5s, servicesActiveCheckLatency7s, servicesActiveCheckLatency10s, servicesActiveCheckLatency12s, servicesActiveCheckLatency15s = histogramProducer(servicesActiveCheckLatencyHundredthSecond, servicesActiveCheckLatencyTenthSecond,
-				servicesActiveCheckLatencyHalfSecond, servicesActiveCheckLatency1s, servicesActiveCheckLatency3s, servicesActiveCheckLatency5s, servicesActiveCheckLatency7s, servicesActiveCheckLatency10s, servicesActiveCheckLatency12s, servicesActiveCheckLatency15s, 0.01, 0.1, 0.5, 1.0, 3.0, 5.0, 7.0, 10.0, 12.5, 15.0, v.Latency)
+	contactObject := contacts{}
+	if e.collectors.Contacts && e.collectAPIResponse(ch, contactResp, contactAPI, &contactObject) {
+		var hostNotificationsEnabledCount, serviceNotificationsEnabledCount float64
+		// contact groups only list the names of their members
+		notificationsEnabled := make(map[string]bool, len(contactObject.Contact))
+
+		for _, v := range contactObject.Contact {
+			if v.HostNotificationsEnabled == 1 {
+				hostNotificationsEnabledCount++
+			}
+			if v.ServiceNotificationsEnabled == 1 {
+				serviceNotificationsEnabledCount++
+			}
+			notificationsEnabled[v.ContactName] = v.HostNotificationsEnabled == 1 || v.ServiceNotificationsEnabled == 1
+		}
 
-			servicesActiveCheckExecutionHundredthSecond, servicesActiveCheckExecutionFifthHundredthSecond,
-				servicesActiveCheckExecutionTenthSecond, servicesActiveCheckExecutionThirdSecond, servicesActiveCheckExecutionHalfSecond, servicesActiveCheckExecutionSeventhSecond, servicesActiveCheckExecution1s, servicesActiveCheckExecution1Halfs, servicesActiveCheckExecution2s, servicesActiveCheckExecution2Halfs = histogramProducer(servicesActiveCheckExecutionHundredthSecond, servicesActiveCheckExecutionFifthHundredthSecond,
-				servicesActiveCheckExecutionTenthSecond, servicesActiveCheckExecutionThirdSecond, servicesActiveCheckExecutionHalfSecond, servicesActiveCheckExecutionSeventhSecond, servicesActiveCheckExecution1s, servicesActiveCheckExecution1Halfs, servicesActiveCheckExecution2s, servicesActiveCheckExecution2Halfs, 0.01, 0.05, 0.1, 0.3, 0.5, 0.7, 1.0, 1.5, 2.0, 2.5, v.ExecutionTime)
+		ch <- prometheus.MustNewConstMetric(
+			contactsTotal, prometheus.GaugeValue, float64(len(contactObject.Contact)),
+		)
+		ch <- prometheus.MustNewConstMetric(
+			contactsNotificationsEnabled, prometheus.GaugeValue, hostNotificationsEnabledCount, "host",
+		)
+		ch <- prometheus.MustNewConstMetric(
+			contactsNotificationsEnabled, prometheus.GaugeValue, serviceNotificationsEnabledCount, "service",
+		)
 
-			servicesActiveCheckLatencySum += v.Latency
-			servicesActiveCheckExecutionSum += v.ExecutionTime
-		} else {
-			servicesPassiveCheckCount++
+		contactgroupMembersObject := contactgroupMembers{}
+		if e.collectAPIResponse(ch, contactgroupMembersResp, contactgroupmembersAPI, &contactgroupMembersObject) {
+			for _, v := range contactgroupMembersObject.Contactgroup {
+				var membersNotificationsEnabledCount float64
+				for _, member := range v.Members.Contact {
+					if notificationsEnabled[member.ContactName] {
+						membersNotificationsEnabledCount++
+					}
+				}
+
+				ch <- prometheus.MustNewConstMetric(
+					contactgroupMembersTotal, prometheus.GaugeValue, float64(len(v.Members.Contact)), v.ContactgroupName,
+				)
+				ch <- prometheus.MustNewConstMetric(
+					contactgroupMembersNotificationsEnabledTotal, prometheus.GaugeValue, membersNotificationsEnabledCount, v.ContactgroupName,
+				)
+			}
 		}
+	}
 
-		switch currentstate := v.CurrentState; currentstate {
-		case 0:
-			servicesOkCount++
-		case 1:
-			servicesWarnCount++
-		case 2:
-			servicesCriticalCount++
-		case 3:
-			servicesUnknownCount++
+	statehistoryObject := statehistory{}
+	if e.collectors.Alerts {
+		e.alertsMutex.Lock()
+		if e.collectAPIResponse(ch, statehistoryResp, statehistoryAPI, &statehistoryObject) {
+			if e.alertCounts == nil {
+				// every state starts at 0 so increase() sees the first alert of each
+				e.alertCounts = map[[2]string]float64{}
+				for _, state := range []string{"up", "down", "unreachable"} {
+					e.alertCounts[[2]string{"host", state}] = 0
+				}
+				for _, state := range []string{"ok", "warn", "critical", "unknown"} {
+					e.alertCounts[[2]string{"service", state}] = 0
+				}
+			}
+
+			if e.alertsCounted == nil {
+				e.alertsCounted = map[stateentry]int64{}
+			}
+			for _, v := range statehistoryObject.Stateentry {
+				if _, ok := e.alertsCounted[v]; ok {
+					continue
+				}
+				e.alertsCounted[v] = alertsUntil
+
+				var labels [2]string
+				if v.ObjecttypeID == 2 {
+					labels = [2]string{"service", status_counts.ServiceState(v.State)}
+				} else {
+					labels = [2]string{"host", status_counts.HostState(v.State)}
+				}
+				// a state change can't be to pending, which is only for states Nagios doesn't define
+				if _, ok := e.alertCounts[labels]; ok {
+					e.alertCounts[labels]++
+				}
+			}
+			e.alertsSince = alertsUntil
+
+			// a state change first counted before the next starttime can't be returned again
+			for v, countedAt := range e.alertsCounted {
+				if countedAt < alertsUntil-int64(alertsLateMargin.Seconds()) {
+					delete(e.alertsCounted, v)
+				}
+			}
 		}
 
-		if v.IsFlapping == 1 {
-			servicesFlapCount++
+		// a failed query is retried from the same starttime on the next scrape, so keep exposing the counts so far
+		for labels, count := range e.alertCounts {
+			ch <- prometheus.MustNewConstMetric(
+				alertsTotal, prometheus.CounterValue, count, labels[:]...,
+			)
 		}
+		e.alertsMutex.Unlock()
+	}
 
-		if v.ScheduledDowntimeDepth == 1 {
-			servicesDowntimeCount++
-		}
+	// reporting zeroes for an endpoint that failed would be misleading, so only update what we could scrape
+	if hostStatusOK {
+		e.UpdateCommonHostMetrics(ch, hostCounts.Total, hostCounts.Active, hostCounts.Passive, hostCounts.Up, hostCounts.Down, hostCounts.Unreachable, hostCounts.Pending,
+			hostCounts.Flapping, hostCounts.Downtime)
+	}
 
-		if v.ProblemHasBeenAcknowledged == 1 {
-			servicesProblemsAcknowledgedCount++
-		}
+	if serviceStatusOK {
+		e.UpdateCommonServiceMetrics(ch, serviceCounts.Total, serviceCounts.Active, serviceCounts.Passive, serviceCounts.Ok, serviceCounts.Warn, serviceCounts.Critical, serviceCounts.Unknown, serviceCounts.Pending,
+			serviceCounts.Flapping, serviceCounts.Downtime)
+	}
+
+	if systemStatusDetailOK {
+		e.UpdateCommonCheckMetrics(ch, systemStatusDetailObject.Nagioscore.Activehostchecks.Val1, systemStatusDetailObject.Nagioscore.Activehostchecks.Val5, systemStatusDetailObject.Nagioscore.Activehostchecks.Val15,
+			systemStatusDetailObject.Nagioscore.Passivehostchecks.Val1, systemStatusDetailObject.Nagioscore.Passivehostchecks.Val5, systemStatusDetailObject.Nagioscore.Passivehostchecks.Val15,
+			systemStatusDetailObject.Nagioscore.Activeservicechecks.Val1, systemStatusDetailObject.Nagioscore.Activeservicechecks.Val5, systemStatusDetailObject.Nagioscore.Activeservicechecks.Val15,
+			systemStatusDetailObject.Nagioscore.Passiveservicechecks.Val1, systemStatusDetailObject.Nagioscore.Passiveservicechecks.Val5, systemStatusDetailObject.Nagioscore.Passiveservicechecks.Val15, systemStatusDetailObject.Nagioscore.Activehostcheckperf.AvgLatency, systemStatusDetailObject.Nagioscore.Activehostcheckperf.MinLatency, systemStatusDetailObject.Nagioscore.Activehostcheckperf.MaxLatency, systemStatusDetailObject.Nagioscore.Activehostcheckperf.AvgExecutionTime, systemStatusDetailObject.Nagioscore.Activehostcheckperf.MinExecutionTime, systemStatusDetailObject.Nagioscore.Activehostcheckperf.MaxExecutionTime, systemStatusDetailObject.Nagioscore.Activeservicecheckperf.AvgLatency, systemStatusDetailObject.Nagioscore.Activeservicecheckperf.MinLatency, systemStatusDetailObject.Nagioscore.Activeservicecheckperf.MaxLatency, systemStatusDetailObject.Nagioscore.Activeservicecheckperf.AvgExecutionTime, systemStatusDetailObject.Nagioscore.Activeservicecheckperf.MinExecutionTime, systemStatusDetailObject.Nagioscore.Activeservicecheckperf.MaxExecutionTime,
+			systemStatusDetailObject.Nagioscore.Passivehostcheckperf.AvgLatency, systemStatusDetailObject.Nagioscore.Passivehostcheckperf.MinLatency, systemStatusDetailObject.Nagioscore.Passivehostcheckperf.MaxLatency,
+			systemStatusDetailObject.Nagioscore.Passiveservicecheckperf.AvgLatency, systemStatusDetailObject.Nagioscore.Passiveservicecheckperf.MinLatency, systemStatusDetailObject.Nagioscore.Passiveservicecheckperf.MaxLatency)
 	}
 
+	log.Info("Endpoint scraped and metrics updated")
+}
+
+// Metrics common to both collection options, split up so a disabled or failing endpoint only skips its own metrics
+
+// metrics nagiostats can't provide, shared by the API and livestatus
+func (e *Exporter) UpdateHostProblemMetrics(ch chan<- prometheus.Metric, hostsAcknowledgedUpCount, hostsAcknowledgedDownCount, hostsAcknowledgedUnreachableCount, hostsHardUpCount, hostsHardDownCount, hostsHardUnreachableCount,
+	hostsNotificationsDisabledCount, hostsChecksDisabledCount, hostsRetryingCount float64) {
 	ch <- prometheus.MustNewConstMetric(
-		servicesProblemsAcknowledged, prometheus.GaugeValue, servicesProblemsAcknowledgedCount,
+		hostsProblemsAcknowledged, prometheus.GaugeValue, hostsAcknowledgedUpCount, "up",
 	)
 
-	ch <- prometheus.MustNewConstHistogram(
-		servicesCheckLatency, uint64(servicesActiveCheckCount), servicesActiveCheckLatencySum, map[float64]uint64{
-			0.01: uint64(servicesActiveCheckLatencyHundredthSecond),
-			0.1:  uint64(servicesActiveCheckLatencyTenthSecond),
-			0.5:  uint64(servicesActiveCheckLatencyHalfSecond),
-			1.0:  uint64(servicesActiveCheckLatency1s),
-			3.0:  uint64(servicesActiveCheckLatency3s),
-			5.0:  uint64(servicesActiveCheckLatency5s),
-			7.0:  uint64(servicesActiveCheckLatency7s),
-			10.0: uint64(servicesActiveCheckLatency10s),
-			12.5: uint64(servicesActiveCheckLatency12s),
-			15.0: uint64(servicesActiveCheckLatency15s)},
-		"active", "latency",
+	ch <- prometheus.MustNewConstMetric(
+		hostsProblemsAcknowledged, prometheus.GaugeValue, hostsAcknowledgedDownCount, "down",
 	)
 
-	ch <- prometheus.MustNewConstHistogram(
-		servicesCheckExecution, uint64(servicesActiveCheckCount), servicesActiveCheckExecutionSum, map[float64]uint64{
-			0.01: uint64(servicesActiveCheckExecutionHundredthSecond),
-			0.05: uint64(servicesActiveCheckExecutionFifthHundredthSecond),
-			0.1:  uint64(servicesActiveCheckExecutionTenthSecond),
-			0.3:  uint64(servicesActiveCheckExecutionThirdSecond),
-			0.5:  uint64(servicesActiveCheckExecutionHalfSecond),
-			0.7:  uint64(servicesActiveCheckExecutionSeventhSecond),
-			1.0:  uint64(servicesActiveCheckExecution1s),
-			1.5:  uint64(servicesActiveCheckExecution1Halfs),
-			2.0:  uint64(servicesActiveCheckExecution2s),
-			2.5:  uint64(servicesActiveCheckExecution2Halfs)},
-		"active", "execution",
+	ch <- prometheus.MustNewConstMetric(
+		hostsProblemsAcknowledged, prometheus.GaugeValue, hostsAcknowledgedUnreachableCount, "unreachable",
 	)
 
-	// system status
-	systemStatusDetailURL := e.nagiosEndpoint + systemstatusDetailAPI + "?apikey=" + e.nagiosAPIKey
-
-	body = QueryAPIs(systemStatusDetailURL, sslVerify, nagiosAPITimeout)
-	log.Debug("Queried API: ", systemstatusDetailAPI)
-
-	systemStatusDetailObject := systemStatusDetail{}
-
-	jsonErr = json.Unmarshal(body, &systemStatusDetailObject)
-	if jsonErr != nil {
-		log.Fatal(jsonErr)
-	}
-
-	// user information
-	// we also need to tack on the optional parameter of `advanced` to get privilege information
-	systemUserURL := e.nagiosEndpoint + systemuserAPI + "?apikey=" + e.nagiosAPIKey + "&advanced=1"
+	ch <- prometheus.MustNewConstMetric(
+		hostsHardStatus, prometheus.GaugeValue, hostsHardUpCount, "up",
+	)
 
-	body = QueryAPIs(systemUserURL, sslVerify, nagiosAPITimeout)
-	log.Debug("Queried API: ", systemuserAPI)
+	ch <- prometheus.MustNewConstMetric(
+		hostsHardStatus, prometheus.GaugeValue, hostsHardDownCount, "down",
+	)
 
-	userStatusObject := userStatus{}
+	ch <- prometheus.MustNewConstMetric(
+		hostsHardStatus, prometheus.GaugeValue, hostsHardUnreachableCount, "unreachable",
+	)
 
-	jsonErr = json.Unmarshal(body, &userStatusObject)
-	if jsonErr != nil {
-		log.Fatal(jsonErr)
-	}
+	ch <- prometheus.MustNewConstMetric(
+		hostsNotificationsDisabled, prometheus.GaugeValue, hostsNotificationsDisabledCount,
+	)
 
-	var usersAdminCount, usersRegularCount, usersEnabledCount, usersDisabledCount float64
+	ch <- prometheus.MustNewConstMetric(
+		hostsChecksDisabled, prometheus.GaugeValue, hostsChecksDisabledCount,
+	)
 
 	ch <- prometheus.MustNewConstMetric(
-		usersTotal, prometheus.GaugeValue, userStatusObject.Recordcount,
+		hostsRetrying, prometheus.GaugeValue, hostsRetryingCount,
 	)
+}
 
-	for _, v := range userStatusObject.Userstatus {
+func (e *Exporter) UpdateServiceProblemMetrics(ch chan<- prometheus.Metric, servicesAcknowledgedOkCount, servicesAcknowledgedWarnCount, servicesAcknowledgedCriticalCount, servicesAcknowledgedUnknownCount, servicesHardOkCount, servicesHardWarnCount, servicesHardCriticalCount, servicesHardUnknownCount,
+	servicesNotificationsDisabledCount, servicesChecksDisabledCount, servicesScheduledCount, servicesRetryingCount float64) {
+	ch <- prometheus.MustNewConstMetric(
+		servicesProblemsAcknowledged, prometheus.GaugeValue, servicesAcknowledgedOkCount, "ok",
+	)
 
-		if v.Admin == 1 {
-			usersAdminCount++
-		} else {
-			usersRegularCount++
-		}
+	ch <- prometheus.MustNewConstMetric(
+		servicesProblemsAcknowledged, prometheus.GaugeValue, servicesAcknowledgedWarnCount, "warn",
+	)
 
-		if v.Enabled == 1 {
-			usersEnabledCount++
-		} else {
-			usersDisabledCount++
-		}
-	}
+	ch <- prometheus.MustNewConstMetric(
+		servicesProblemsAcknowledged, prometheus.GaugeValue, servicesAcknowledgedCriticalCount, "critical",
+	)
 
 	ch <- prometheus.MustNewConstMetric(
-		usersStatus, prometheus.GaugeValue, usersEnabledCount, "enabled",
+		servicesProblemsAcknowledged, prometheus.GaugeValue, servicesAcknowledgedUnknownCount, "unknown",
 	)
 
 	ch <- prometheus.MustNewConstMetric(
-		usersStatus, prometheus.GaugeValue, usersDisabledCount, "disabled",
+		servicesHardStatus, prometheus.GaugeValue, servicesHardOkCount, "ok",
 	)
 
 	ch <- prometheus.MustNewConstMetric(
-		usersPrivileges, prometheus.GaugeValue, usersAdminCount, "admin",
+		servicesHardStatus, prometheus.GaugeValue, servicesHardWarnCount, "warn",
 	)
 
 	ch <- prometheus.MustNewConstMetric(
-		usersPrivileges, prometheus.GaugeValue, usersRegularCount, "user",
+		servicesHardStatus, prometheus.GaugeValue, servicesHardCriticalCount, "critical",
 	)
 
-	e.UpdateCommonMetrics(ch, hostsCount, hostsActiveCheckCount, hostsPassiveCheckCount, hostsUpCount, hostsDownCount, hostsUnreachableCount,
-		hostsFlapCount, hostsDowntimeCount,
-		servicesCount, servicesActiveCheckCount, servicesPassiveCheckCount, servicesOkCount, servicesWarnCount, servicesCriticalCount, servicesUnknownCount,
-		servicesFlapCount, servicesDowntimeCount,
-		systemStatusDetailObject.Nagioscore.Activehostchecks.Val1, systemStatusDetailObject.Nagioscore.Activehostchecks.Val5, systemStatusDetailObject.Nagioscore.Activehostchecks.Val15,
-		systemStatusDetailObject.Nagioscore.Passivehostchecks.Val1, systemStatusDetailObject.Nagioscore.Passivehostchecks.Val5, systemStatusDetailObject.Nagioscore.Passivehostchecks.Val15,
-		systemStatusDetailObject.Nagioscore.Activeservicechecks.Val1, systemStatusDetailObject.Nagioscore.Activeservicechecks.Val5, systemStatusDetailObject.Nagioscore.Activeservicechecks.Val15,
-		systemStatusDetailObject.Nagioscore.Passiveservicechecks.Val1, systemStatusDetailObject.Nagioscore.Passiveservicechecks.Val5, systemStatusDetailObject.Nagioscore.Passiveservicechecks.Val15, systemStatusDetailObject.Nagioscore.Activehostcheckperf.AvgLatency, systemStatusDetailObject.Nagioscore.Activehostcheckperf.MinLatency, systemStatusDetailObject.Nagioscore.Activehostcheckperf.MaxLatency, systemStatusDetailObject.Nagioscore.Activehostcheckperf.AvgExecutionTime, systemStatusDetailObject.Nagioscore.Activehostcheckperf.MinExecutionTime, systemStatusDetailObject.Nagioscore.Activehostcheckperf.MaxExecutionTime, systemStatusDetailObject.Nagioscore.Activeservicecheckperf.AvgLatency, systemStatusDetailObject.Nagioscore.Activeservicecheckperf.MinLatency, systemStatusDetailObject.Nagioscore.Activeservicecheckperf.MaxLatency, systemStatusDetailObject.Nagioscore.Activeservicecheckperf.AvgExecutionTime, systemStatusDetailObject.Nagioscore.Activeservicecheckperf.MinExecutionTime, systemStatusDetailObject.Nagioscore.Activeservicecheckperf.MaxExecutionTime)
+	ch <- prometheus.MustNewConstMetric(
+		servicesHardStatus, prometheus.GaugeValue, servicesHardUnknownCount, "unknown",
+	)
 
-	log.Info("Endpoint scraped and metrics updated")
-}
+	ch <- prometheus.MustNewConstMetric(
+		servicesNotificationsDisabled, prometheus.GaugeValue, servicesNotificationsDisabledCount,
+	)
 
-func (e *Exporter) UpdateCommonMetrics(ch chan<- prometheus.Metric, hostsCount, hostsActiveCheckCount, hostsPassiveCheckCount, hostsUpCount, hostsDownCount, hostsUnreachableCount,
-	hostsFlapCount, hostsDowntimeCount, servicesCount, servicesActiveCheckCount, servicesPassiveCheckCount, servicesOkCount, servicesWarnCount, servicesCriticalCount, servicesUnknownCount,
-	servicesFlapCount, servicesDowntimeCount,
-	activehostchecks1m, activehostchecks5m, activehostchecks15m, passivehostchecks1m, passivehostchecks5m, passivehostchecks15m,
-	activeservicechecks1m, activeservicechecks5m, activeservicechecks15m, passiveservicechecks1m, passiveservicechecks5m, passiveservicechecks15m, activehostchecklatencyavg, activehostchecklatencymin, activehostchecklatencymax, activehostcheckexecutionavg, activehostcheckexecutionmin, activehostcheckexecutionmax, activeservicechecklatencyavg, activeservicechecklatencymin, activeservicechecklatencymax, activeservicecheckexecutionavg, activeservicecheckexecutionmin, activeservicecheckexecutionmax float64) {
+	ch <- prometheus.MustNewConstMetric(
+		servicesChecksDisabled, prometheus.GaugeValue, servicesChecksDisabledCount,
+	)
 
-	// Metrics common to both collection options
+	ch <- prometheus.MustNewConstMetric(
+		servicesScheduled, prometheus.GaugeValue, servicesScheduledCount,
+	)
 
 	ch <- prometheus.MustNewConstMetric(
-		buildInfo, prometheus.GaugeValue, 1, Version, BuildDate, Commit,
+		servicesRetrying, prometheus.GaugeValue, servicesRetryingCount,
 	)
+}
 
-	// host status
+func (e *Exporter) UpdateCommonHostMetrics(ch chan<- prometheus.Metric, hostsCount, hostsActiveCheckCount, hostsPassiveCheckCount, hostsUpCount, hostsDownCount, hostsUnreachableCount, hostsPendingCount,
+	hostsFlapCount, hostsDowntimeCount float64) {
 
 	ch <- prometheus.MustNewConstMetric(
 		hostsTotal, prometheus.GaugeValue, hostsCount,
@@ -802,6 +2072,10 @@ func (e *Exporter) UpdateCommonMetrics(ch chan<- prometheus.Metric, hostsCount,
 		hostsStatus, prometheus.GaugeValue, hostsUnreachableCount, "unreachable",
 	)
 
+	ch <- prometheus.MustNewConstMetric(
+		hostsStatus, prometheus.GaugeValue, hostsPendingCount, "pending",
+	)
+
 	ch <- prometheus.MustNewConstMetric(
 		hostsStatus, prometheus.GaugeValue, hostsFlapCount, "flapping",
 	)
@@ -809,8 +2083,10 @@ func (e *Exporter) UpdateCommonMetrics(ch chan<- prometheus.Metric, hostsCount,
 	ch <- prometheus.MustNewConstMetric(
 		hostsDowntime, prometheus.GaugeValue, hostsDowntimeCount,
 	)
+}
 
-	// service status
+func (e *Exporter) UpdateCommonServiceMetrics(ch chan<- prometheus.Metric, servicesCount, servicesActiveCheckCount, servicesPassiveCheckCount, servicesOkCount, servicesWarnCount, servicesCriticalCount, servicesUnknownCount, servicesPendingCount,
+	servicesFlapCount, servicesDowntimeCount float64) {
 
 	ch <- prometheus.MustNewConstMetric(
 		servicesTotal, prometheus.GaugeValue, servicesCount,
@@ -840,6 +2116,10 @@ func (e *Exporter) UpdateCommonMetrics(ch chan<- prometheus.Metric, hostsCount,
 		servicesStatus, prometheus.GaugeValue, servicesUnknownCount, "unknown",
 	)
 
+	ch <- prometheus.MustNewConstMetric(
+		servicesStatus, prometheus.GaugeValue, servicesPendingCount, "pending",
+	)
+
 	ch <- prometheus.MustNewConstMetric(
 		servicesStatus, prometheus.GaugeValue, servicesFlapCount, "flapping",
 	)
@@ -847,6 +2127,11 @@ func (e *Exporter) UpdateCommonMetrics(ch chan<- prometheus.Metric, hostsCount,
 	ch <- prometheus.MustNewConstMetric(
 		servicesDowntime, prometheus.GaugeValue, servicesDowntimeCount,
 	)
+}
+
+func (e *Exporter) UpdateCommonCheckMetrics(ch chan<- prometheus.Metric, activehostchecks1m, activehostchecks5m, activehostchecks15m, passivehostchecks1m, passivehostchecks5m, passivehostchecks15m,
+	activeservicechecks1m, activeservicechecks5m, activeservicechecks15m, passiveservicechecks1m, passiveservicechecks5m, passiveservicechecks15m, activehostchecklatencyavg, activehostchecklatencymin, activehostchecklatencymax, activehostcheckexecutionavg, activehostcheckexecutionmin, activehostcheckexecutionmax, activeservicechecklatencyavg, activeservicechecklatencymin, activeservicechecklatencymax, activeservicecheckexecutionavg, activeservicecheckexecutionmin, activeservicecheckexecutionmax,
+	passivehostchecklatencyavg, passivehostchecklatencymin, passivehostchecklatencymax, passiveservicechecklatencyavg, passiveservicechecklatencymin, passiveservicechecklatencymax float64) {
 
 	activeHostCheckSum := activehostchecks1m + activehostchecks5m + activehostchecks15m
 
@@ -884,6 +2169,9 @@ func (e *Exporter) UpdateCommonMetrics(ch chan<- prometheus.Metric, hostsCount,
 			15: uint64(passiveservicechecks15m)}, "passive",
 	)
 
+	ch <- prometheus.MustNewConstMetric(hostChecksRate, prometheus.GaugeValue, (activehostchecks5m+passivehostchecks5m)/(5*60))
+	ch <- prometheus.MustNewConstMetric(serviceChecksRate, prometheus.GaugeValue, (activeservicechecks5m+passiveservicechecks5m)/(5*60))
+
 	// active host check performance
 	ch <- prometheus.MustNewConstMetric(
 		hostchecksPerformance, prometheus.GaugeValue, activehostchecklatencyavg, "active", "latency", "avg",
@@ -909,6 +2197,19 @@ func (e *Exporter) UpdateCommonMetrics(ch chan<- prometheus.Metric, hostsCount,
 		hostchecksPerformance, prometheus.GaugeValue, activehostcheckexecutionmax, "active", "execution", "max",
 	)
 
+	// passive host check performance
+	ch <- prometheus.MustNewConstMetric(
+		hostchecksPerformance, prometheus.GaugeValue, passivehostchecklatencyavg, "passive", "latency", "avg",
+	)
+
+	ch <- prometheus.MustNewConstMetric(
+		hostchecksPerformance, prometheus.GaugeValue, passivehostchecklatencymin, "passive", "latency", "min",
+	)
+
+	ch <- prometheus.MustNewConstMetric(
+		hostchecksPerformance, prometheus.GaugeValue, passivehostchecklatencymax, "passive", "latency", "max",
+	)
+
 	// active service check performance
 	ch <- prometheus.MustNewConstMetric(
 		servicechecksPerformance, prometheus.GaugeValue, activeservicechecklatencyavg, "active", "latency", "avg",
@@ -934,12 +2235,24 @@ func (e *Exporter) UpdateCommonMetrics(ch chan<- prometheus.Metric, hostsCount,
 		servicechecksPerformance, prometheus.GaugeValue, activeservicecheckexecutionmax, "active", "execution", "max",
 	)
 
+	// passive service check performance
+	ch <- prometheus.MustNewConstMetric(
+		servicechecksPerformance, prometheus.GaugeValue, passiveservicechecklatencyavg, "passive", "latency", "avg",
+	)
+
+	ch <- prometheus.MustNewConstMetric(
+		servicechecksPerformance, prometheus.GaugeValue, passiveservicechecklatencymin, "passive", "latency", "min",
+	)
+
+	ch <- prometheus.MustNewConstMetric(
+		servicechecksPerformance, prometheus.GaugeValue, passiveservicechecklatencymax, "passive", "latency", "max",
+	)
 }
 
 func (e *Exporter) QueryNagiostatsAndUpdateMetrics(ch chan<- prometheus.Metric, nagiostatsPath string, nagiosconfigPath string) {
 	// to get specific values, we output them in MRTG format
-	// we pass a comma seperated string of MRTG data - must be manually kept up to date
-	mrtgList := "NAGIOSVERSION,NUMHOSTS,NUMHSTACTCHK60M,NUMHSTPSVCHK60M,NUMHSTUP,NUMHSTDOWN,NUMHSTUNR,NUMHSTFLAPPING,NUMHSTDOWNTIME,NUMSERVICES,NUMSVCACTCHK60M,NUMSVCPSVCHK60M,NUMSVCOK,NUMSVCWARN,NUMSVCUNKN,NUMSVCCRIT,NUMSVCFLAPPING,NUMSVCDOWNTIME,NUMHSTACTCHK1M,NUMHSTACTCHK5M,NUMHSTACTCHK15M,NUMHSTPSVCHK1M,NUMHSTPSVCHK5M,NUMHSTPSVCHK15M,NUMSVCACTCHK1M,NUMSVCACTCHK5M,NUMSVCACTCHK15M,NUMSVCPSVCHK1M,NUMSVCPSVCHK5M,NUMSVCPSVCHK15M,AVGACTHSTLAT,MINACTHSTLAT,MAXACTHSTLAT,AVGACTHSTEXT,MINACTHSTEXT,MAXACTHSTEXT,AVGACTSVCLAT,MINACTSVCLAT,MAXACTSVCLAT,AVGACTSVCEXT,MINACTSVCEXT,MAXACTSVCEXT"
+	// we pass a comma seperated string of MRTG data - must be manually kept up to date in parse_nagiostats
+	mrtgList := strings.Join(parse_nagiostats.MRTGVariables, ",")
 
 	// -m = mrtg; -D = use comma as delimiter, -d = MRTG list input
 	cmd := exec.Command(nagiostatsPath, "-c", nagiosconfigPath, "-m", "-D", ",", "-d", mrtgList)
@@ -949,54 +2262,65 @@ func (e *Exporter) QueryNagiostatsAndUpdateMetrics(ch chan<- prometheus.Metric,
 	err := cmd.Run()
 
 	if err != nil {
-		log.Fatal(err)
+		e.scrapeErrorCount.Add(1)
+		log.Warn("Failed to query nagiostats: ", err)
+		return
 	}
 	log.Debug("Queried nagiostats: ", out.String())
-	// input our comma seperated list as metrics
-	cmdSplice := strings.Split(out.String(), ",")
 
-	// Need float64 values for metrics
-	metricSlice := make([]float64, 0, len(cmdSplice))
+	stats, err := parse_nagiostats.ParseMRTG(out.String())
+	if err != nil {
+		e.scrapeErrorCount.Add(1)
+		log.Warn("Unexpected nagiostats output: ", err)
+		return
+	}
 
-	for _, metric := range cmdSplice {
-		metric, _ := strconv.ParseFloat(metric, 64)
-		metricSlice = append(metricSlice, metric)
+	// Need float64 values for metrics
+	stat := func(variable string) float64 {
+		value, err := parse_nagiostats.Value(stats, variable)
+		if err != nil {
+			log.Error(err)
+		}
+		return value
 	}
 
-	var nagiosVersion string = cmdSplice[0] // NAGIOSVERSION
+	var nagiosVersion string = stats["NAGIOSVERSION"]
 	ch <- prometheus.MustNewConstMetric(
 		// we do want this value to be a string though as it's a label
 		versionInfo, prometheus.GaugeValue, 1, nagiosVersion,
 	)
 
 	// host status
-	var hostsCount, hostsActiveCheckCount, hostsPassiveCheckCount, hostsUpCount, hostsDownCount, hostsUnreachableCount, hostsFlapCount, hostsDowntimeCount float64
+	var hostsCount, hostsActiveCheckCount, hostsPassiveCheckCount, hostsUpCount, hostsDownCount, hostsUnreachableCount, hostsPendingCount, hostsFlapCount, hostsDowntimeCount float64
 
 	// maintaining variables for each of these makes it slightly easier to parse
 	// its really horrible but not sure there's a better way
 
-	hostsCount = metricSlice[1]             // NUMHOSTS
-	hostsActiveCheckCount = metricSlice[2]  // NUMHSTACTCHK60M - technically only hosts actively checked in last hour
-	hostsPassiveCheckCount = metricSlice[3] // NUMHSTPSVCHK60M
-	hostsUpCount = metricSlice[4]           // NUMHSTUP
-	hostsDownCount = metricSlice[5]         // NUMHSTDOWN
-	hostsUnreachableCount = metricSlice[6]  // NUMHSTUNR
-	hostsFlapCount = metricSlice[7]         // NUMHSTFLAPPING
-	hostsDowntimeCount = metricSlice[8]     // NUMHSTDOWNTIME
+	hostsCount = stat("NUMHOSTS")
+	hostsActiveCheckCount = stat("NUMHSTACTCHK60M") // technically only hosts actively checked in last hour
+	hostsPassiveCheckCount = stat("NUMHSTPSVCHK60M")
+	hostsUpCount = stat("NUMHSTUP")
+	hostsDownCount = stat("NUMHSTDOWN")
+	hostsUnreachableCount = stat("NUMHSTUNR")
+	hostsFlapCount = stat("NUMHSTFLAPPING")
+	hostsDowntimeCount = stat("NUMHSTDOWNTIME")
+	// nagiostats leaves hosts that were never checked out of every state
+	hostsPendingCount = math.Max(0, hostsCount-hostsUpCount-hostsDownCount-hostsUnreachableCount)
 
 	// service status
 	var servicesCount, servicesActiveCheckCount,
-		servicesPassiveCheckCount, servicesOkCount, servicesWarnCount, servicesUnknownCount, servicesCriticalCount, servicesFlapCount, servicesDowntimeCount float64
-
-	servicesCount = metricSlice[9]              // NUMSERVICES
-	servicesActiveCheckCount = metricSlice[10]  // NUMSVCACTCHK60M
-	servicesPassiveCheckCount = metricSlice[11] // NUMSVCPSVCHK60M
-	servicesOkCount = metricSlice[12]           // NUMSVCOK
-	servicesWarnCount = metricSlice[13]         // NUMSVCWARN
-	servicesUnknownCount = metricSlice[14]      // NUMSVCUNKN
-	servicesCriticalCount = metricSlice[15]     // NUMSVCCRIT
-	servicesFlapCount = metricSlice[16]         // NUMSVCFLAPPING
-	servicesDowntimeCount = metricSlice[17]     // NUMSVCDOWNTIME
+		servicesPassiveCheckCount, servicesOkCount, servicesWarnCount, servicesUnknownCount, servicesCriticalCount, servicesPendingCount, servicesFlapCount, servicesDowntimeCount float64
+
+	servicesCount = stat("NUMSERVICES")
+	servicesActiveCheckCount = stat("NUMSVCACTCHK60M")
+	servicesPassiveCheckCount = stat("NUMSVCPSVCHK60M")
+	servicesOkCount = stat("NUMSVCOK")
+	servicesWarnCount = stat("NUMSVCWARN")
+	servicesUnknownCount = stat("NUMSVCUNKN")
+	servicesCriticalCount = stat("NUMSVCCRIT")
+	servicesFlapCount = stat("NUMSVCFLAPPING")
+	servicesDowntimeCount = stat("NUMSVCDOWNTIME")
+	servicesPendingCount = math.Max(0, servicesCount-servicesOkCount-servicesWarnCount-servicesCriticalCount-servicesUnknownCount)
 
 	// check performance
 	var activehostchecks1m, activehostchecks5m, activehostchecks15m,
@@ -1004,126 +2328,518 @@ func (e *Exporter) QueryNagiostatsAndUpdateMetrics(ch chan<- prometheus.Metric,
 		activeservicechecks1m, activeservicechecks5m, activeservicechecks15m,
 		passiveservicechecks1m, passiveservicechecks5m, passiveservicechecks15m float64
 
-	activehostchecks1m = metricSlice[18]   // NUMHSTACTCHK1M
-	activehostchecks5m = metricSlice[19]   // NUMHSTACTCHK5M
-	activehostchecks15m = metricSlice[20]  // NUMHSTACTCHK15M
-	passivehostchecks1m = metricSlice[21]  // NUMHSTPSVCHK1M
-	passivehostchecks5m = metricSlice[22]  // NUMHSTPSVCHK5M
-	passivehostchecks15m = metricSlice[23] // NUMHSTPSVCHK15M
+	activehostchecks1m = stat("NUMHSTACTCHK1M")
+	activehostchecks5m = stat("NUMHSTACTCHK5M")
+	activehostchecks15m = stat("NUMHSTACTCHK15M")
+	passivehostchecks1m = stat("NUMHSTPSVCHK1M")
+	passivehostchecks5m = stat("NUMHSTPSVCHK5M")
+	passivehostchecks15m = stat("NUMHSTPSVCHK15M")
 
-	activeservicechecks1m = metricSlice[24]   // NUMSVCACTCHK1M
-	activeservicechecks5m = metricSlice[25]   // NUMSVCACTCHK5M
-	activeservicechecks15m = metricSlice[26]  // NUMSVCACTCHK15M
-	passiveservicechecks1m = metricSlice[27]  // NUMSVCPSVCHK1M
-	passiveservicechecks5m = metricSlice[28]  // NUMSVCPSVCHK5M
-	passiveservicechecks15m = metricSlice[29] // NUMSVCPSVCHK15M
+	activeservicechecks1m = stat("NUMSVCACTCHK1M")
+	activeservicechecks5m = stat("NUMSVCACTCHK5M")
+	activeservicechecks15m = stat("NUMSVCACTCHK15M")
+	passiveservicechecks1m = stat("NUMSVCPSVCHK1M")
+	passiveservicechecks5m = stat("NUMSVCPSVCHK5M")
+	passiveservicechecks15m = stat("NUMSVCPSVCHK15M")
 
 	var activehostchecklatencyavg, activehostchecklatencymin, activehostchecklatencymax,
 		activehostcheckexecutionavg, activehostcheckexecutionmin, activehostcheckexecutionmax,
 		activeservicechecklatencyavg, activeservicechecklatencymin, activeservicechecklatencymax,
 		activeservicecheckexecutionavg, activeservicecheckexecutionmin, activeservicecheckexecutionmax float64
 
-	activehostchecklatencyavg = metricSlice[30] // AVGACTHSTLAT
-	activehostchecklatencymin = metricSlice[31] // MINACTHSTLAT
-	activehostchecklatencymax = metricSlice[32] // MAXACTHSTLAT
+	activehostchecklatencyavg = stat("AVGACTHSTLAT")
+	activehostchecklatencymin = stat("MINACTHSTLAT")
+	activehostchecklatencymax = stat("MAXACTHSTLAT")
 
-	activehostcheckexecutionavg = metricSlice[33] // AVGACTHSTEXT
-	activehostcheckexecutionmin = metricSlice[34] // MINACTHSTEXT
-	activehostcheckexecutionmax = metricSlice[35] // MAXACTHSTEXT
+	activehostcheckexecutionavg = stat("AVGACTHSTEXT")
+	activehostcheckexecutionmin = stat("MINACTHSTEXT")
+	activehostcheckexecutionmax = stat("MAXACTHSTEXT")
 
-	activeservicechecklatencyavg = metricSlice[36] // AVGACTSVCLAT
-	activeservicechecklatencymin = metricSlice[37] // MINACTSVCLAT
-	activeservicechecklatencymax = metricSlice[38] // MAXACTSVCLAT
+	activeservicechecklatencyavg = stat("AVGACTSVCLAT")
+	activeservicechecklatencymin = stat("MINACTSVCLAT")
+	activeservicechecklatencymax = stat("MAXACTSVCLAT")
 
-	activeservicecheckexecutionavg = metricSlice[39] // AVGACTSVCEXT
-	activeservicecheckexecutionmin = metricSlice[40] // MINACTSVCEXT
-	activeservicecheckexecutionmax = metricSlice[41] // MAXACTSVCEXT
+	activeservicecheckexecutionavg = stat("AVGACTSVCEXT")
+	activeservicecheckexecutionmin = stat("MINACTSVCEXT")
+	activeservicecheckexecutionmax = stat("MAXACTSVCEXT")
 
-	e.UpdateCommonMetrics(ch, hostsCount, hostsActiveCheckCount, hostsPassiveCheckCount, hostsUpCount, hostsDownCount, hostsUnreachableCount,
-		hostsFlapCount, hostsDowntimeCount,
-		servicesCount, servicesActiveCheckCount, servicesPassiveCheckCount, servicesOkCount, servicesWarnCount, servicesCriticalCount, servicesUnknownCount,
-		servicesFlapCount, servicesDowntimeCount,
-		activehostchecks1m, activehostchecks5m, activehostchecks15m,
-		passivehostchecks1m, passivehostchecks5m, passivehostchecks15m,
-		activeservicechecks1m, activeservicechecks5m, activeservicechecks15m,
-		passiveservicechecks1m, passiveservicechecks5m, passiveservicechecks15m, activehostchecklatencyavg, activehostchecklatencymin, activehostchecklatencymax, activehostcheckexecutionavg, activehostcheckexecutionmin, activehostcheckexecutionmax, activeservicechecklatencyavg, activeservicechecklatencymin, activeservicechecklatencymax, activeservicecheckexecutionavg, activeservicecheckexecutionmin, activeservicecheckexecutionmax)
+	var passivehostchecklatencyavg, passivehostchecklatencymin, passivehostchecklatencymax,
+		passiveservicechecklatencyavg, passiveservicechecklatencymin, passiveservicechecklatencymax float64
+
+	passivehostchecklatencyavg = stat("AVGPSVHSTLAT")
+	passivehostchecklatencymin = stat("MINPSVHSTLAT")
+	passivehostchecklatencymax = stat("MAXPSVHSTLAT")
+
+	passiveservicechecklatencyavg = stat("AVGPSVSVCLAT")
+	passiveservicechecklatencymin = stat("MINPSVSVCLAT")
+	passiveservicechecklatencymax = stat("MAXPSVSVCLAT")
+
+	if e.collectors.HostStatus {
+		e.UpdateCommonHostMetrics(ch, hostsCount, hostsActiveCheckCount, hostsPassiveCheckCount, hostsUpCount, hostsDownCount, hostsUnreachableCount, hostsPendingCount,
+			hostsFlapCount, hostsDowntimeCount)
+	}
+
+	if e.collectors.ServiceStatus {
+		e.UpdateCommonServiceMetrics(ch, servicesCount, servicesActiveCheckCount, servicesPassiveCheckCount, servicesOkCount, servicesWarnCount, servicesCriticalCount, servicesUnknownCount, servicesPendingCount,
+			servicesFlapCount, servicesDowntimeCount)
+	}
+
+	if e.collectors.StatusDetail {
+		e.UpdateCommonCheckMetrics(ch, activehostchecks1m, activehostchecks5m, activehostchecks15m,
+			passivehostchecks1m, passivehostchecks5m, passivehostchecks15m,
+			activeservicechecks1m, activeservicechecks5m, activeservicechecks15m,
+			passiveservicechecks1m, passiveservicechecks5m, passiveservicechecks15m, activehostchecklatencyavg, activehostchecklatencymin, activehostchecklatencymax, activehostcheckexecutionavg, activehostcheckexecutionmin, activehostcheckexecutionmax, activeservicechecklatencyavg, activeservicechecklatencymin, activeservicechecklatencymax, activeservicecheckexecutionavg, activeservicecheckexecutionmin, activeservicecheckexecutionmax,
+			passivehostchecklatencyavg, passivehostchecklatencymin, passivehostchecklatencymax, passiveservicechecklatencyavg, passiveservicechecklatencymin, passiveservicechecklatencymax)
+	}
 
 	log.Info("Nagiostats scraped and metrics updated")
 }
 
-func CompareNagiosVersions(latestVersion string, currentVersion string) float64 {
-	xiPrefix := "xi-" // NagiosXI versions always start with this
-	cleanLatestVersion := strings.Trim(latestVersion, xiPrefix)
-	cleanCurrentVersion := strings.Trim(currentVersion, xiPrefix)
+// every `Stats:` line is a value in the response, in the same order
+// a header followed by several `Stats:` and a `StatsAnd: 2` counts objects matching both of the previous two filters
+const livestatusHostsQuery = `GET hosts
+Stats: state >= 0
+Stats: check_type = 0
+Stats: check_type = 1
+Stats: state = 0
+Stats: state = 1
+Stats: state = 2
+Stats: is_flapping = 1
+Stats: scheduled_downtime_depth > 0
+Stats: state = 0
+Stats: acknowledged = 1
+StatsAnd: 2
+Stats: state = 1
+Stats: acknowledged = 1
+StatsAnd: 2
+Stats: state = 2
+Stats: acknowledged = 1
+StatsAnd: 2
+Stats: state = 0
+Stats: state_type = 1
+StatsAnd: 2
+Stats: state = 1
+Stats: state_type = 1
+StatsAnd: 2
+Stats: state = 2
+Stats: state_type = 1
+StatsAnd: 2
+Stats: notifications_enabled = 0
+Stats: active_checks_enabled = 0
+Stats: state > 2
+Stats: state_type = 0
+Stats: current_attempt > 1
+StatsAnd: 2`
+
+const livestatusServicesQuery = `GET services
+Stats: state >= 0
+Stats: check_type = 0
+Stats: check_type = 1
+Stats: state = 0
+Stats: state = 1
+Stats: state = 2
+Stats: state = 3
+Stats: is_flapping = 1
+Stats: scheduled_downtime_depth > 0
+Stats: state = 0
+Stats: acknowledged = 1
+StatsAnd: 2
+Stats: state = 1
+Stats: acknowledged = 1
+StatsAnd: 2
+Stats: state = 2
+Stats: acknowledged = 1
+StatsAnd: 2
+Stats: state = 3
+Stats: acknowledged = 1
+StatsAnd: 2
+Stats: state = 0
+Stats: state_type = 1
+StatsAnd: 2
+Stats: state = 1
+Stats: state_type = 1
+StatsAnd: 2
+Stats: state = 2
+Stats: state_type = 1
+StatsAnd: 2
+Stats: state = 3
+Stats: state_type = 1
+StatsAnd: 2
+Stats: notifications_enabled = 0
+Stats: active_checks_enabled = 0
+Stats: should_be_scheduled = 1
+Stats: state > 3
+Stats: state_type = 0
+Stats: current_attempt > 1
+StatsAnd: 2`
+
+func (e *Exporter) TestLivestatusConnectivity(livestatusSocket string, nagiosAPITimeout time.Duration) (float64, string) {
+	rows, err := livestatus.Query(livestatusSocket, nagiosAPITimeout, "GET status\nColumns: program_version")
+	if err != nil {
+		e.scrapeErrorCount.Add(1)
+		log.Warn("Failed to query livestatus: ", err)
+		return 0, ""
+	}
+
+	if len(rows) != 1 || len(rows[0]) != 1 {
+		e.scrapeErrorCount.Add(1)
+		log.Warn("Unexpected livestatus status response: ", rows)
+		return 0, ""
+	}
+
+	version, _ := rows[0][0].(string)
+
+	return 1, version
+}
+
+func (e *Exporter) QueryLivestatusAndUpdateMetrics(ch chan<- prometheus.Metric, livestatusSocket string, nagiosAPITimeout time.Duration, nagiosVersion string) {
+	ch <- prometheus.MustNewConstMetric(
+		versionInfo, prometheus.GaugeValue, 1, nagiosVersion,
+	)
+
+	if e.collectors.HostStatus {
+		stats, err := livestatus.QueryStats(livestatusSocket, nagiosAPITimeout, livestatusHostsQuery)
+		if err != nil {
+			e.scrapeErrorCount.Add(1)
+			log.Warn("Failed to query livestatus hosts: ", err)
+		} else if len(stats) != 18 {
+			// the values are parsed positionally below, so bail out rather than index past the end
+			e.scrapeErrorCount.Add(1)
+			log.Warn("Unexpected livestatus hosts response, got ", len(stats), " values")
+		} else {
+			// total, active, passive, up, down, unreachable, pending, flapping, downtime
+			e.UpdateCommonHostMetrics(ch, stats[0], stats[1], stats[2], stats[3], stats[4], stats[5], stats[16], stats[6], stats[7])
+			// acknowledged up, down, unreachable, hard up, hard down, hard unreachable, notifications disabled, active checks disabled, retrying
+			e.UpdateHostProblemMetrics(ch, stats[8], stats[9], stats[10], stats[11], stats[12], stats[13], stats[14], stats[15], stats[17])
+		}
+	}
+
+	if e.collectors.ServiceStatus {
+		stats, err := livestatus.QueryStats(livestatusSocket, nagiosAPITimeout, livestatusServicesQuery)
+		if err != nil {
+			e.scrapeErrorCount.Add(1)
+			log.Warn("Failed to query livestatus services: ", err)
+		} else if len(stats) != 22 {
+			e.scrapeErrorCount.Add(1)
+			log.Warn("Unexpected livestatus services response, got ", len(stats), " values")
+		} else {
+			// total, active, passive, ok, warn, critical, unknown, pending, flapping, downtime
+			e.UpdateCommonServiceMetrics(ch, stats[0], stats[1], stats[2], stats[3], stats[4], stats[5], stats[6], stats[20], stats[7], stats[8])
+			// acknowledged ok, warn, critical, unknown, hard ok, hard warn, hard critical, hard unknown, notifications disabled, active checks disabled, scheduled, retrying
+			e.UpdateServiceProblemMetrics(ch, stats[9], stats[10], stats[11], stats[12], stats[13], stats[14], stats[15], stats[16], stats[17], stats[18], stats[19], stats[21])
+		}
+	}
 
-	log.Debug("NagiosXI latest version: ", cleanLatestVersion)
-	log.Debug("NagiosXI current version: ", cleanCurrentVersion)
+	if e.collectors.Groups {
+		for _, group := range []struct {
+			query string
+			desc  *prometheus.Desc
+		}{
+			{"GET hostgroups\nColumns: name num_hosts", hostgroupMembersTotal},
+			{"GET servicegroups\nColumns: name num_services", servicegroupMembersTotal},
+		} {
+			rows, err := livestatus.Query(livestatusSocket, nagiosAPITimeout, group.query)
+			if err != nil {
+				e.scrapeErrorCount.Add(1)
+				log.Warn("Failed to query livestatus groups: ", err)
+				continue
+			}
+
+			for _, row := range rows {
+				if len(row) != 2 {
+					continue
+				}
+				name, nameOK := row[0].(string)
+				members, membersOK := row[1].(float64)
+				if !nameOK || !membersOK {
+					continue
+				}
+				ch <- prometheus.MustNewConstMetric(
+					group.desc, prometheus.GaugeValue, members, name,
+				)
+			}
+		}
+	}
+}
 
-	// convert into version object for semver comparison
-	semVerLatest, err := version.NewVersion(cleanLatestVersion)
+func (e *Exporter) ReadStatusFile(statusFile string) ([]parse_statusdat.Block, error) {
+	file, err := os.Open(statusFile)
 	if err != nil {
-		log.Info(err)
+		e.scrapeErrorCount.Add(1)
+		return nil, err
 	}
-	semVerCurrent, err := version.NewVersion(cleanCurrentVersion)
+	defer file.Close()
+
+	blocks, err := parse_statusdat.Parse(file)
 	if err != nil {
-		log.Info(err)
+		e.scrapeErrorCount.Add(1)
+		return nil, fmt.Errorf("parsing %s: %w", statusFile, err)
+	}
+
+	return blocks, nil
+}
+
+// UpdateStatusFileMetrics counts the hoststatus and servicestatus blocks of status.dat into the same metrics as livestatus
+func (e *Exporter) UpdateStatusFileMetrics(ch chan<- prometheus.Metric, blocks []parse_statusdat.Block) {
+	var hostCounts status_counts.HostCounts
+	var serviceCounts status_counts.ServiceCounts
+	// status.dat counts nested downtimes too, unlike the API's depth of 1
+	var hostsDowntimeCount, servicesDowntimeCount float64
+
+	for _, block := range blocks {
+		switch block.Type {
+		case "info":
+			ch <- prometheus.MustNewConstMetric(
+				versionInfo, prometheus.GaugeValue, 1, block.Fields["version"],
+			)
+		case "hoststatus":
+			host := status_counts.HostFromStatusFile(block.Fields)
+			hostCounts.Add(host)
+			if host.ScheduledDowntimeDepth > 0 {
+				hostsDowntimeCount++
+			}
+		case "servicestatus":
+			service := status_counts.ServiceFromStatusFile(block.Fields)
+			serviceCounts.Add(service)
+			if service.ScheduledDowntimeDepth > 0 {
+				servicesDowntimeCount++
+			}
+		}
+	}
+
+	if e.collectors.HostStatus {
+		e.UpdateCommonHostMetrics(ch, hostCounts.Total, hostCounts.Active, hostCounts.Passive, hostCounts.Up, hostCounts.Down, hostCounts.Unreachable, hostCounts.Pending,
+			hostCounts.Flapping, hostsDowntimeCount)
+		e.UpdateHostProblemMetrics(ch, hostCounts.AcknowledgedUp, hostCounts.AcknowledgedDown, hostCounts.AcknowledgedUnreachable, hostCounts.HardUp, hostCounts.HardDown, hostCounts.HardUnreachable,
+			hostCounts.NotificationsDisabled, hostCounts.ChecksDisabled, hostCounts.Retrying)
 	}
 
-	if semVerCurrent.LessThan(semVerLatest) {
-		return 1 // 1 = nagios update is available
+	if e.collectors.ServiceStatus {
+		e.UpdateCommonServiceMetrics(ch, serviceCounts.Total, serviceCounts.Active, serviceCounts.Passive, serviceCounts.Ok, serviceCounts.Warn, serviceCounts.Critical, serviceCounts.Unknown, serviceCounts.Pending,
+			serviceCounts.Flapping, servicesDowntimeCount)
+		e.UpdateServiceProblemMetrics(ch, serviceCounts.AcknowledgedOk, serviceCounts.AcknowledgedWarn, serviceCounts.AcknowledgedCritical, serviceCounts.AcknowledgedUnknown,
+			serviceCounts.HardOk, serviceCounts.HardWarn, serviceCounts.HardCritical, serviceCounts.HardUnknown, serviceCounts.NotificationsDisabled, serviceCounts.ChecksDisabled,
+			serviceCounts.Scheduled, serviceCounts.Retrying)
 	}
-	return 0 // 0 = no nagios update available
 }
 
-// custom formatter modified from https://github.com/sirupsen/logrus/issues/719#issuecomment-536459432
-// https://stackoverflow.com/questions/48971780/how-to-change-the-format-of-log-output-in-logrus/48972299#48972299
-// required as Nagios XI API only supports giving the API token as a URL parameter, and thus can be leaked in the logs
-type nagiosFormatter struct {
-	log.TextFormatter
-	APIKey string
+// assets.nagios.com isn't Nagios, so it gets neither the TLS config nor the API timeout
+func newUpdatesClient(proxyURL *url.URL, checkUpdatesTimeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout:   checkUpdatesTimeout,
+		Transport: &http.Transport{Proxy: proxyFunc(proxyURL)},
+	}
+}
+
+func (e *Exporter) UpdateVersionMetric(ch chan<- prometheus.Metric, currentVersion string) {
+	latestVersion, err := get_nagios_version.GetLatestNagiosXIVersion(e.updatesClient, e.checkUpdatesURL)
+	if err != nil {
+		// don't abandon exporter just for version updater issues
+		log.Warn("Skipping NagiosXI update check: ", err)
+		return
+	}
+
+	log.Debug("NagiosXI latest version: ", latestVersion)
+	log.Debug("NagiosXI current version: ", currentVersion)
+
+	// the versions page has changed or been unavailable before, never emit a comparison we can't trust
+	updateAvailableValue, err := get_nagios_version.UpdateAvailable(latestVersion, currentVersion)
+	if err != nil {
+		log.Warn("Skipping NagiosXI update check: ", err)
+		return
+	}
+
+	var updateMetric float64 // 0 = no update, 1 = update available
+	if updateAvailableValue {
+		updateMetric = 1
+	}
+
+	ch <- prometheus.MustNewConstMetric(
+		updateAvailable, prometheus.GaugeValue, updateMetric,
+		strings.TrimPrefix(currentVersion, get_nagios_version.XIVersionPrefix), strings.TrimPrefix(latestVersion, get_nagios_version.XIVersionPrefix),
+	)
+}
+
+// a socket left behind by an exporter that didn't shut down cleanly would make net.Listen fail, so it's removed first
+func listenUnixSocket(path string) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		// don't steal the socket from an exporter that's still running
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("%s is already in use", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	// only the owner and group may connect, e.g a local Prometheus agent sharing the exporter's group
+	if err := os.Chmod(path, 0660); err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	return listener, nil
 }
 
-func (f *nagiosFormatter) Format(entry *log.Entry) ([]byte, error) {
-	log, newEntry := f.TextFormatter.Format(entry)
+// exporter-toolkit expects a go-kit logger, so hand its key/value pairs over to logrus
+type toolkitLogger struct{}
+
+func (l toolkitLogger) Log(keyvals ...interface{}) error {
+	fields := log.Fields{}
+	var msg, level string
+
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		key := fmt.Sprint(keyvals[i])
+		switch key {
+		case "msg":
+			msg = fmt.Sprint(keyvals[i+1])
+		case "level":
+			level = fmt.Sprint(keyvals[i+1])
+		default:
+			fields[key] = keyvals[i+1]
+		}
+	}
 
-	// there might be a better way to do this but, convert our log byte array to a string
-	logString := string(log[:])
-	// replace the secret APIKey with junk
-	cleanString := strings.ReplaceAll(logString, f.APIKey, "<redactedAPIKey>")
-	// return it to a byte and pass it on
-	cleanLog := []byte(cleanString)
+	entry := log.WithFields(fields)
+	switch level {
+	case "error":
+		entry.Error(msg)
+	case "warn":
+		entry.Warn(msg)
+	case "debug":
+		entry.Debug(msg)
+	default:
+		entry.Info(msg)
+	}
 
-	return bytes.Trim(cleanLog, f.APIKey), newEntry
+	return nil
 }
 
 func main() {
 
 	var (
 		listenAddress = flag.String("web.listen-address", ":9927",
-			"Address to listen on for telemetry")
+			"Address to listen on for telemetry, or unix:/path/to.sock to listen on a unix socket")
 		metricsPath = flag.String("web.telemetry-path", "/metrics",
 			"Path under which to expose metrics")
+		routePrefix = flag.String("web.route-prefix", "",
+			"Prefix of every path served, e.g /nagios-exporter when behind a reverse proxy")
+		landingPageTitle = flag.String("web.landing-page-title", "Nagios Exporter",
+			"Title of the landing page, e.g the name of the Nagios it watches")
+		webConfigFile = flag.String("web.config.file", "",
+			"Path to configuration file that can enable TLS or authentication, see https://github.com/prometheus/exporter-toolkit/blob/master/docs/web-configuration.md")
 		remoteAddress = flag.String("nagios.scrape-uri", "http://localhost",
 			"Nagios application address")
+		proxyURL = flag.String("nagios.proxy-url", "",
+			"HTTP proxy for reaching the Nagios API and NagiosXI versions page, defaults to the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables")
 		sslVerify = flag.Bool("nagios.ssl-verify", false,
 			"SSL certificate validation")
+		userAgent = flag.String("nagios.user-agent", "nagios_exporter/"+Version,
+			"User-Agent header of requests to the Nagios API")
+		tlsCertFile = flag.String("nagios.tls-cert-file", "",
+			"Client certificate file for mutual TLS to the Nagios API, requires --nagios.tls-key-file")
+		tlsKeyFile = flag.String("nagios.tls-key-file", "",
+			"Client private key file for mutual TLS to the Nagios API, requires --nagios.tls-cert-file")
+		tlsCAFile = flag.String("nagios.tls-ca-file", "",
+			"CA certificate file to verify the Nagios API certificate, enables certificate validation regardless of --nagios.ssl-verify")
+		tlsServerName = flag.String("nagios.tls-server-name", "",
+			"Hostname to verify the Nagios API certificate against and send as SNI, instead of the host of --nagios.scrape-uri")
 		// I think users would rather enter `5` over `5s`, e.g int vs Duration flag
 		nagiosAPITimeout = flag.Int("nagios.timeout", 5,
 			"Timeout for querying Nagios API in seconds")
 		configPath = flag.String("config.path", "/etc/prometheus-nagios-exporter/config.toml",
 			"Config file path")
+		nagiosUsername = flag.String("nagios.username", "",
+			"Username for HTTP basic auth to Nagios, overrides Username from the config file")
+		nagiosPassword = flag.String("nagios.password", "",
+			"Password for HTTP basic auth to Nagios, overrides Password from the config file. Prefer the config file to keep it off the command line")
+		apiKeyFile = flag.String("config.api-key-file", "",
+			"File containing the Nagios XI API key, overrides the "+apiKeyEnvVar+" environment variable and the config file")
 		logLevel = flag.String("log.level", "info",
 			"Minimum Log level [debug, info]")
+		logFormat = flag.String("log.format", "text",
+			"Log output format [text, json]")
 		statsBinary = flag.String("nagios.stats_binary", "",
 			"Path of nagiostats binary and configuration (e.g /usr/local/nagios/bin/nagiostats -c /usr/local/nagios/etc/nagios.cfg)")
 		nagiosConfigPath = flag.String("nagios.config_path", "",
 			"Nagios configuration path for use with nagiostats binary (e.g /usr/local/nagios/etc/nagios.cfg)")
+		livestatusSocket = flag.String("nagios.livestatus-socket", "",
+			"MK Livestatus unix socket path (e.g /usr/local/nagios/var/rw/live) or TCP address (e.g localhost:6557) to query instead of the Nagios XI API")
+		statusFile = flag.String("nagios.status-file", "",
+			"Nagios Core status.dat path (e.g /usr/local/nagios/var/status.dat) to read instead of the Nagios XI API")
 		checkUpdates = flag.Bool("nagios.check-updates", false,
 			"Provides a metric on whether a NagiosXI update is available")
+		checkUpdatesURL = flag.String("nagios.check-updates-url", NagiosXIURL,
+			"NagiosXI versions page used by --nagios.check-updates")
+		checkUpdatesTimeout = flag.Duration("nagios.check-updates-timeout", 5*time.Second,
+			"Timeout fetching --nagios.check-updates-url, the update check is skipped when it's exceeded")
+		latencyBucketsFlag = flag.String("nagios.latency-buckets", "0.01,0.1,0.5,1,3,5,7,10,12.5,15",
+			"Comma separated upper bounds in seconds of the nagios_host_checks_latency and nagios_service_checks_latency histogram buckets")
+		perfdata = flag.Bool("nagios.perfdata", false,
+			"Export nagios_service_perfdata parsed from the performance data of every service. Emits a series per perfdata label of every service, so cardinality grows with the number of services")
+		collectHostStatus = flag.Bool("collector.hoststatus", true,
+			"Enable the host status collector")
+		collectServiceStatus = flag.Bool("collector.servicestatus", true,
+			"Enable the service status collector")
+		collectStatusDetail = flag.Bool("collector.statusdetail", true,
+			"Enable the check performance collector")
+		collectUsers = flag.Bool("collector.users", true,
+			"Enable the users collector (Nagios XI only)")
+		collectGroups = flag.Bool("collector.groups", true,
+			"Enable the host group and service group collector (Nagios XI only)")
+		collectDowntime = flag.Bool("collector.downtime", true,
+			"Enable the scheduled downtime collector (Nagios XI only)")
+		collectComments = flag.Bool("collector.comments", true,
+			"Enable the comments and acknowledgement age collector (Nagios XI only)")
+		collectContacts = flag.Bool("collector.contacts", false,
+			"Enable the contacts and contact group collector (Nagios XI only)")
+		collectAlerts = flag.Bool("collector.alerts", false,
+			"Enable the host and service state change collector (Nagios XI only)")
+		alertsLookback = flag.Duration("collector.alerts.lookback", time.Hour,
+			"How far back nagios_alerts_total starts counting state changes from on the first scrape, e.g 24h")
+		cacheTTL = flag.Duration("nagios.cache-ttl", 0,
+			"Serve repeated scrapes from cached Nagios API responses for this long, e.g 10s. 0 disables the cache")
+		authMode = flag.String("nagios.auth-mode", "query",
+			"How the Nagios XI API key is sent [query, header]. header sends it as the X-API-KEY header, which newer Nagios XI versions accept, keeping it out of request URLs")
+		retries = flag.Int("nagios.retries", 0,
+			"Retry Nagios API requests failing with a connection error, timeout or 5xx this many times, with exponential backoff within --nagios.timeout")
+		pageSize = flag.Int("nagios.page-size", 0,
+			"Query the hoststatus and servicestatus APIs in pages of this many records, for large installations where they time out. 0 queries every object at once")
+		perHost = flag.Bool("nagios.per-host", false,
+			"Export the nagios_host_* last check, last state change, notifications enabled, active checks enabled, current attempt and max attempts metrics per host with a host_name label. Emits 6 series per host, so cardinality grows with the number of hosts")
+		check = flag.Bool("check", false,
+			"Check the configuration and that Nagios can be reached, then exit with 0 on success or 1 on failure instead of serving metrics")
+		perService = flag.Bool("nagios.per-service", false,
+			"Export nagios_service_state and the nagios_service_* last check, last state change, notifications enabled, active checks enabled, current attempt and max attempts metrics per service with host_name and service_description labels. Emits up to 9 series per service, so cardinality grows with the number of services")
 	)
 
+	headers := headerFlag{}
+	flag.Var(headers, "nagios.header", "Additional `key=value` header of requests to the Nagios API, can be repeated")
+
 	flag.Parse()
 
+	if *authMode != "query" && *authMode != "header" {
+		log.Fatal("Unknown --nagios.auth-mode: ", *authMode)
+	}
+
+	switch *logFormat {
+	case "text":
+		log.SetFormatter(&log.TextFormatter{})
+	case "json":
+		log.SetFormatter(&log.JSONFormatter{})
+	default:
+		log.Fatal("Unknown log format: ", *logFormat)
+	}
+
 	if *logLevel == "debug" {
 		log.SetLevel(log.DebugLevel)
 		log.Debug("Log level set to debug")
@@ -1131,41 +2847,296 @@ func main() {
 		log.SetLevel(log.InfoLevel)
 	}
 
-	var nagiosURL string
 	var conf Config
+	// guards conf, which is swapped by a SIGHUP configuration reload
+	var confMutex sync.RWMutex
+	redactionHook := &redact.Hook{}
 
-	// if we _aren't_ using nagiostats, it'll be a blank string
-	if *statsBinary == "" {
-		conf = ReadConfig(*configPath)
+	// re-run on every SIGHUP so credentials can be rotated without a restart
+	loadConfig := func() (Config, error) {
+		conf, err := ReadConfig(*configPath)
+		if err != nil {
+			return conf, err
+		}
+
+		apiKey, err := ResolveAPIKey(conf, *apiKeyFile)
+		if err != nil {
+			return conf, err
+		}
+		conf.APIKey = apiKey
+
+		if *nagiosUsername != "" {
+			conf.Username = *nagiosUsername
+		}
+		if *nagiosPassword != "" {
+			conf.Password = *nagiosPassword
+		}
+
+		apiKeys := []string{conf.APIKey}
+		for _, t := range conf.Targets {
+			apiKeys = append(apiKeys, t.APIKey)
+		}
+		for _, i := range conf.Instances {
+			apiKeys = append(apiKeys, i.APIKey)
+		}
+		redactionHook.SetSecrets(apiKeys, conf.Password)
+		configLastReload.Store(time.Now().Unix())
+
+		return conf, nil
+	}
+
+	modes := 0
+	for _, mode := range []string{*statsBinary, *livestatusSocket, *statusFile} {
+		if mode != "" {
+			modes++
+		}
+	}
+	if modes > 1 {
+		log.Fatal("Only one of --nagios.stats_binary, --nagios.livestatus-socket and --nagios.status-file can be used")
+	}
 
-		formatter := nagiosFormatter{}
-		formatter.APIKey = conf.APIKey
-		log.SetFormatter(&formatter)
+	// if we _aren't_ using nagiostats, livestatus or status.dat, it'll be a blank string
+	if *statsBinary == "" && *livestatusSocket == "" && *statusFile == "" {
+		log.AddHook(redactionHook)
 
-		nagiosURL = *remoteAddress + nagiosAPIVersion + apiSlug
+		var err error
+		conf, err = loadConfig()
+		if err != nil {
+			log.Fatal(err)
+		}
 	} else {
-		// if we're using nagiostats, set a dummy API key here
+		// if we're using nagiostats or livestatus, set a dummy API key here
 		conf.APIKey = ""
 	}
 
-	// convert timeout flag to seconds
-	exporter := NewExporter(nagiosURL, conf.APIKey, *sslVerify, time.Duration(*nagiosAPITimeout)*time.Second, *statsBinary, *nagiosConfigPath, *checkUpdates)
-	prometheus.MustRegister(exporter)
+	var nagiosProxyURL *url.URL
+	if *proxyURL != "" {
+		var err error
+		nagiosProxyURL, err = url.Parse(*proxyURL)
+		if err != nil {
+			log.Fatal("Invalid proxy URL: ", err)
+		}
+	}
+
+	tlsConfig, err := NewTLSConfig(*sslVerify, *tlsCertFile, *tlsKeyFile, *tlsCAFile, *tlsServerName)
+	if err != nil {
+		log.Fatal("Invalid TLS configuration: ", err)
+	}
+
+	latencyBuckets, err := ParseBuckets(*latencyBucketsFlag)
+	if err != nil {
+		log.Fatal("Invalid --nagios.latency-buckets: ", err)
+	}
+
+	collectors := Collectors{
+		HostStatus:    *collectHostStatus,
+		ServiceStatus: *collectServiceStatus,
+		StatusDetail:  *collectStatusDetail,
+		Users:         *collectUsers,
+		Groups:        *collectGroups,
+		Downtime:      *collectDowntime,
+		Comments:      *collectComments,
+		Contacts:      *collectContacts,
+		Alerts:        *collectAlerts,
+	}
+
+	// instances and targets only override ScrapeURI and APIKey, guarded by confMutex like conf
+	options := ExporterOptions{
+		ScrapeURI:           *remoteAddress,
+		APIKey:              conf.APIKey,
+		Username:            conf.Username,
+		Password:            conf.Password,
+		ProxyURL:            nagiosProxyURL,
+		TLSConfig:           tlsConfig,
+		UserAgent:           *userAgent,
+		Headers:             http.Header(headers),
+		APITimeout:          time.Duration(*nagiosAPITimeout) * time.Second,
+		NagiostatsPath:      *statsBinary,
+		NagiosConfigPath:    *nagiosConfigPath,
+		LivestatusSocket:    *livestatusSocket,
+		StatusFile:          *statusFile,
+		CheckUpdates:        *checkUpdates,
+		CheckUpdatesURL:     *checkUpdatesURL,
+		CheckUpdatesTimeout: *checkUpdatesTimeout,
+		PerHost:             *perHost,
+		PerService:          *perService,
+		Perfdata:            *perfdata,
+		LatencyBuckets:      latencyBuckets,
+		Collectors:          collectors,
+		CacheTTL:            *cacheTTL,
+		PageSize:            *pageSize,
+		AlertsLookback:      *alertsLookback,
+		Retries:             *retries,
+		AuthMode:            *authMode,
+	}
+
+	// kept to swap in new credentials on a SIGHUP configuration reload
+	var exporter *Exporter
+	instanceExporters := make(map[string]*Exporter, len(conf.Instances))
+	// ?target= exporters by scrape URI, kept across scrapes so the cache, connections and nagios_alerts_total carry over,
+	// and rebuilt on a SIGHUP reload as the targets and their API keys may have changed.
+	// targetsMutex guards it between concurrent scrapes, a reload holds confMutex instead
+	var targetsMutex sync.Mutex
+	targetExporters := make(map[string]*Exporter)
+
+	if len(conf.Instances) == 0 {
+		exporter = NewExporter(options)
+		prometheus.MustRegister(exporter)
+	} else {
+		// every instance is its own collector, so one failing instance only affects its own metrics and nagios_up
+		seenInstances := make(map[string]bool, len(conf.Instances))
+		for _, instance := range conf.Instances {
+			if instance.Name == "" || instance.ScrapeURI == "" {
+				log.Fatal("Every instance in the configuration file needs a Name and ScrapeURI")
+			}
+			if seenInstances[instance.Name] {
+				log.Fatal("Duplicate instance in the configuration file: ", instance.Name)
+			}
+			seenInstances[instance.Name] = true
+
+			instanceOptions := options
+			instanceOptions.ScrapeURI, instanceOptions.APIKey = instance.ScrapeURI, instance.APIKey
+			instanceExporter := NewExporter(instanceOptions)
+			prometheus.WrapRegistererWith(prometheus.Labels{"instance": instance.Name}, prometheus.DefaultRegisterer).MustRegister(instanceExporter)
+			instanceExporters[instance.Name] = instanceExporter
+			log.Info("Using instance ", instance.Name, ": ", instance.ScrapeURI)
+		}
+	}
 
-	if *statsBinary == "" {
+	if *livestatusSocket != "" {
+		log.Info("Using livestatus socket: ", *livestatusSocket)
+	} else if *statusFile != "" {
+		log.Info("Using status file: ", *statusFile)
+	} else if *statsBinary == "" && len(conf.Instances) == 0 {
 		log.Info("Using connection endpoint: ", *remoteAddress)
 	} else {
 		log.Info("Using nagiostats binary: ", *statsBinary)
 		log.Info("Using Nagios configiration: ", *nagiosConfigPath)
 	}
 
-	http.Handle(*metricsPath, promhttp.Handler())
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+	if *check {
+		checkExporters := map[string]*Exporter{"": exporter}
+		if exporter == nil {
+			checkExporters = instanceExporters
+		}
+		for name, checkExporter := range checkExporters {
+			if err := checkExporter.CheckConnectivity(time.Duration(*nagiosAPITimeout) * time.Second); err != nil {
+				if name != "" {
+					err = fmt.Errorf("instance %s: %w", name, err)
+				}
+				// through the log so the redaction hook scrubs any API key or password from the error
+				log.Fatal("Check failed: ", err)
+			}
+		}
+		fmt.Println("OK")
+		return
+	}
+
+	if *statsBinary == "" && *livestatusSocket == "" && *statusFile == "" {
+		reload := make(chan os.Signal, 1)
+		signal.Notify(reload, syscall.SIGHUP)
+
+		go func() {
+			for range reload {
+				newConf, err := loadConfig()
+				if err != nil {
+					// keep scraping with the last good configuration
+					log.Error("Failed to reload configuration: ", err)
+					continue
+				}
+
+				if exporter != nil {
+					exporter.SetCredentials(newConf.APIKey, newConf.Username, newConf.Password)
+				}
+				for _, instance := range newConf.Instances {
+					instanceExporter, ok := instanceExporters[instance.Name]
+					if !ok {
+						log.Warn("Adding instances requires a restart, ignoring new instance: ", instance.Name)
+						continue
+					}
+					instanceExporter.SetCredentials(instance.APIKey, newConf.Username, newConf.Password)
+				}
+
+				confMutex.Lock()
+				conf = newConf
+				options.APIKey, options.Username, options.Password = newConf.APIKey, newConf.Username, newConf.Password
+				for _, targetExporter := range targetExporters {
+					targetExporter.client.CloseIdleConnections()
+				}
+				targetExporters = make(map[string]*Exporter)
+				confMutex.Unlock()
+
+				log.Info("Reloaded configuration: ", *configPath)
+			}
+		}()
+	}
+
+	// `/nagios-exporter/` and `nagios-exporter` both serve under /nagios-exporter
+	prefix := strings.TrimSuffix(*routePrefix, "/")
+	if prefix != "" && !strings.HasPrefix(prefix, "/") {
+		prefix = "/" + prefix
+	}
+
+	defaultHandler := promhttp.Handler()
+	http.HandleFunc(prefix+*metricsPath, func(w http.ResponseWriter, r *http.Request) {
+		target := r.URL.Query().Get("target")
+		// without a target we scrape the Nagios instance configured at startup
+		if target == "" {
+			defaultHandler.ServeHTTP(w, r)
+			return
+		}
+
+		if *statsBinary != "" || *livestatusSocket != "" || *statusFile != "" {
+			http.Error(w, "The target parameter is only supported with the Nagios XI API", http.StatusBadRequest)
+			return
+		}
+
+		confMutex.RLock()
+		// only scrape targets we have an API key for, the exporter shouldn't query arbitrary URLs
+		targetAPIKey, ok := conf.TargetAPIKey(target)
+		var targetExporter *Exporter
+		if ok {
+			// `https://nagios/` and `https://nagios` share an exporter
+			targetURI := strings.TrimSuffix(target, "/")
+			targetsMutex.Lock()
+			targetExporter, ok = targetExporters[targetURI]
+			if !ok {
+				targetOptions := options
+				targetOptions.ScrapeURI, targetOptions.APIKey = targetURI, targetAPIKey
+				targetExporter = NewExporter(targetOptions)
+				targetExporters[targetURI] = targetExporter
+			}
+			targetsMutex.Unlock()
+		}
+		confMutex.RUnlock()
+
+		if targetExporter == nil {
+			http.Error(w, "Unknown target: "+target, http.StatusBadRequest)
+			return
+		}
+		log.Debug("Scraping target: ", target)
+
+		registry := prometheus.NewRegistry()
+		registry.MustRegister(targetExporter)
+		promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+	})
+	healthExporters := []*Exporter{exporter}
+	if exporter == nil {
+		healthExporters = nil
+		for _, instanceExporter := range instanceExporters {
+			healthExporters = append(healthExporters, instanceExporter)
+		}
+	}
+	http.Handle(prefix+"/healthz", &healthCheck{exporters: healthExporters})
+
+	title := html.EscapeString(*landingPageTitle)
+	http.HandleFunc(prefix+"/", func(w http.ResponseWriter, r *http.Request) {
 		_, err := w.Write([]byte(`<html>
-			<head><title>Nagios Exporter</title></head>
+			<head><title>` + title + `</title></head>
 			<body>
-			<h1>Nagios Exporter</h1>
-			<p><a href='` + *metricsPath + `'>Metrics</a></p>
+			<h1>` + title + `</h1>
+			<p><a href='` + prefix + *metricsPath + `'>Metrics</a></p>
+			<p><a href='` + prefix + `/healthz'>Health</a></p>
 			</body>
 			</html>`))
 		if err != nil {
@@ -1173,5 +3144,25 @@ func main() {
 		}
 	})
 
-	log.Fatal(http.ListenAndServe(*listenAddress, nil))
+	// systemd socket activation isn't supported, we only listen on the address given
+	systemdSocket := false
+	toolkitFlags := &web.FlagConfig{
+		WebListenAddresses: &[]string{*listenAddress},
+		WebSystemdSocket:   &systemdSocket,
+		WebConfigFile:      webConfigFile,
+	}
+
+	server := &http.Server{}
+
+	if strings.HasPrefix(*listenAddress, unixSocketPrefix) {
+		socketPath := strings.TrimPrefix(*listenAddress, unixSocketPrefix)
+		listener, err := listenUnixSocket(socketPath)
+		if err != nil {
+			log.Fatal("Failed to listen on unix socket: ", err)
+		}
+		log.Info("Listening on unix socket: ", socketPath)
+		log.Fatal(web.Serve(listener, server, toolkitFlags, toolkitLogger{}))
+	}
+
+	log.Fatal(web.ListenAndServe(server, toolkitFlags, toolkitLogger{}))
 }
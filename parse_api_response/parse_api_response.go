@@ -0,0 +1,80 @@
+package parse_api_response
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"strings"
+)
+
+// how much of a body that isn't JSON is quoted in errors, enough to recognise e.g a login page
+const snippetLength = 100
+
+// CheckContentType fails a response that isn't JSON, e.g the HTML login page Nagios XI answers an expired
+// session with under a 200. A JSON body is still accepted under another Content-Type, as a misconfigured
+// web server in front of Nagios may label it text/html
+func CheckContentType(contentType string, body []byte) error {
+	if looksLikeJSON(body) {
+		return nil
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || !isJSONMediaType(mediaType) {
+		if contentType == "" {
+			contentType = "no Content-Type"
+		}
+		return fmt.Errorf("expected a JSON response but got %s: %s", contentType, snippet(body))
+	}
+
+	return nil
+}
+
+// Unmarshal is json.Unmarshal quoting the start of a body that isn't JSON at all, so the error shows what Nagios sent instead
+func Unmarshal(body []byte, v interface{}) error {
+	if err := json.Unmarshal(body, v); err != nil {
+		if !looksLikeJSON(body) {
+			return fmt.Errorf("%w, the response isn't JSON: %s", err, snippet(body))
+		}
+		return err
+	}
+
+	return nil
+}
+
+// APIError is the top-level error of a response that is otherwise valid JSON, e.g `{"error": "Invalid API Key"}`
+// which Nagios XI answers a wrong API key with under a 200. Unmarshaling it into any response struct would
+// succeed with every field left empty
+func APIError(body []byte) error {
+	var response struct {
+		Error string `json:"error"`
+	}
+	// arrays and non-string errors aren't Nagios XI errors
+	if err := json.Unmarshal(body, &response); err != nil || response.Error == "" {
+		return nil
+	}
+
+	return fmt.Errorf("Nagios API returned an error: %s", response.Error)
+}
+
+func isJSONMediaType(mediaType string) bool {
+	return mediaType == "application/json" || mediaType == "text/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// every Nagios XI API response is an object, or an array for a few endpoints
+func looksLikeJSON(body []byte) bool {
+	body = bytes.TrimSpace(body)
+	return len(body) > 0 && (body[0] == '{' || body[0] == '[')
+}
+
+// the start of a body on a single line, e.g `<html><head><title>Login · Nagios XI</title>...`
+func snippet(body []byte) string {
+	text := strings.Join(strings.Fields(string(body)), " ")
+	if text == "" {
+		return "empty body"
+	}
+	if len(text) > snippetLength {
+		return fmt.Sprintf("%q...", text[:snippetLength])
+	}
+	return fmt.Sprintf("%q", text)
+}
@@ -0,0 +1,52 @@
+package parse_nagiostats
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// MRTGVariables are requested from `nagiostats -m -d` and printed back in the same order
+// nagiostats has no throughput totals like NUMSVCCHECKS5M, those are the sum of the active and passive 5M variables,
+// and no NUMSVCCHKCRIT either, critical services are NUMSVCCRIT
+// https://assets.nagios.com/downloads/nagioscore/docs/nagioscore/4/en/nagiostats.html
+var MRTGVariables = []string{
+	"NAGIOSVERSION",
+	"NUMHOSTS", "NUMHSTACTCHK60M", "NUMHSTPSVCHK60M", "NUMHSTUP", "NUMHSTDOWN", "NUMHSTUNR", "NUMHSTFLAPPING", "NUMHSTDOWNTIME",
+	"NUMSERVICES", "NUMSVCACTCHK60M", "NUMSVCPSVCHK60M", "NUMSVCOK", "NUMSVCWARN", "NUMSVCUNKN", "NUMSVCCRIT", "NUMSVCFLAPPING", "NUMSVCDOWNTIME",
+	"NUMHSTACTCHK1M", "NUMHSTACTCHK5M", "NUMHSTACTCHK15M", "NUMHSTPSVCHK1M", "NUMHSTPSVCHK5M", "NUMHSTPSVCHK15M",
+	"NUMSVCACTCHK1M", "NUMSVCACTCHK5M", "NUMSVCACTCHK15M", "NUMSVCPSVCHK1M", "NUMSVCPSVCHK5M", "NUMSVCPSVCHK15M",
+	"AVGACTHSTLAT", "MINACTHSTLAT", "MAXACTHSTLAT", "AVGACTHSTEXT", "MINACTHSTEXT", "MAXACTHSTEXT",
+	"AVGACTSVCLAT", "MINACTSVCLAT", "MAXACTSVCLAT", "AVGACTSVCEXT", "MINACTSVCEXT", "MAXACTSVCEXT",
+	"AVGPSVHSTLAT", "MINPSVHSTLAT", "MAXPSVHSTLAT", "AVGPSVSVCLAT", "MINPSVSVCLAT", "MAXPSVSVCLAT",
+}
+
+// ParseMRTG maps the comma delimited output of `nagiostats -m -D , -d <MRTGVariables>` to each variable name
+// so callers look values up by name instead of by position
+func ParseMRTG(output string) (map[string]string, error) {
+	// trim the trailing newline, otherwise the last value can't be parsed
+	values := strings.Split(strings.TrimSpace(output), ",")
+
+	if len(values) < len(MRTGVariables) {
+		return nil, fmt.Errorf("got %d values but expected %d", len(values), len(MRTGVariables))
+	}
+
+	stats := make(map[string]string, len(MRTGVariables))
+	for i, variable := range MRTGVariables {
+		stats[variable] = values[i]
+	}
+
+	return stats, nil
+}
+
+// Value is the number nagiostats printed for variable, an empty or unparsable value counts as 0
+// a variable missing from MRTGVariables is an error, as it would otherwise also read as 0
+func Value(stats map[string]string, variable string) (float64, error) {
+	raw, ok := stats[variable]
+	if !ok {
+		return 0, fmt.Errorf("%s isn't requested from nagiostats", variable)
+	}
+
+	value, _ := strconv.ParseFloat(raw, 64)
+	return value, nil
+}
@@ -0,0 +1,146 @@
+package parse_perfdata
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Perfdata is a single `'label'=value[UOM];[warn];[crit];[min];[max]` item of plugin performance data
+// https://nagios-plugins.org/doc/guidelines.html#AEN200
+type Perfdata struct {
+	Label string
+	// normalized to Unit, e.g 150ms is 0.15 seconds
+	Value float64
+	// seconds, bytes, percent, counter or empty when the plugin gave no unit of measurement
+	Unit string
+	// thresholds may be ranges like `10:20` or `@10:20`, so they're kept as the plugin wrote them
+	Warn, Crit, Min, Max string
+}
+
+var valueRegex = regexp.MustCompile(`^([-+]?(?:[0-9]+\.?[0-9]*|\.[0-9]+)(?:[eE][-+]?[0-9]+)?)([a-zA-Z%]*)$`)
+
+// multiplier to the base unit of every unit of measurement in the plugin guidelines
+var units = map[string]struct {
+	unit       string
+	multiplier float64
+}{
+	"":   {"", 1},
+	"s":  {"seconds", 1},
+	"ms": {"seconds", 1e-3},
+	"us": {"seconds", 1e-6},
+	"%":  {"percent", 1},
+	"B":  {"bytes", 1},
+	"KB": {"bytes", 1024},
+	"MB": {"bytes", 1024 * 1024},
+	"GB": {"bytes", 1024 * 1024 * 1024},
+	"TB": {"bytes", 1024 * 1024 * 1024 * 1024},
+	"c":  {"counter", 1},
+}
+
+// ParsePerfdata parses every item of a perfdata string like `load1=0.5;1.0;2.0 'free space'=20%;;;0;100`
+// malformed items are skipped and reported in the error, while the well formed ones are still returned
+func ParsePerfdata(perfdata string) ([]Perfdata, error) {
+	var parsed []Perfdata
+	var malformed []string
+
+	for _, item := range splitPerfdata(perfdata) {
+		p, err := parseItem(item)
+		if err != nil {
+			malformed = append(malformed, err.Error())
+			continue
+		}
+		// `U` means the plugin couldn't determine the value, which isn't an error
+		if p == nil {
+			continue
+		}
+		parsed = append(parsed, *p)
+	}
+
+	if len(malformed) > 0 {
+		return parsed, fmt.Errorf("malformed perfdata: %s", strings.Join(malformed, ", "))
+	}
+
+	return parsed, nil
+}
+
+// split on whitespace, except within quoted labels which may contain spaces
+func splitPerfdata(perfdata string) []string {
+	var items []string
+	var current strings.Builder
+	quoted := false
+
+	for _, r := range perfdata {
+		switch {
+		case r == '\'':
+			quoted = !quoted
+			current.WriteRune(r)
+		case (r == ' ' || r == '\t' || r == '\n') && !quoted:
+			if current.Len() > 0 {
+				items = append(items, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteRune(r)
+		}
+	}
+
+	if current.Len() > 0 {
+		items = append(items, current.String())
+	}
+
+	return items
+}
+
+func parseItem(item string) (*Perfdata, error) {
+	separator := strings.LastIndex(item, "=")
+	if separator < 1 {
+		return nil, fmt.Errorf("%q has no label", item)
+	}
+
+	label := item[:separator]
+	if strings.HasPrefix(label, "'") && strings.HasSuffix(label, "'") && len(label) > 1 {
+		// two single quotes are an escaped quote within a quoted label
+		label = strings.ReplaceAll(label[1:len(label)-1], "''", "'")
+	}
+	if label == "" {
+		return nil, fmt.Errorf("%q has no label", item)
+	}
+
+	fields := strings.Split(item[separator+1:], ";")
+	if fields[0] == "U" {
+		return nil, nil
+	}
+
+	match := valueRegex.FindStringSubmatch(fields[0])
+	if match == nil {
+		return nil, fmt.Errorf("%q has an invalid value", item)
+	}
+
+	unit, ok := units[match[2]]
+	if !ok {
+		return nil, fmt.Errorf("%q has an unknown unit of measurement", item)
+	}
+
+	value, err := strconv.ParseFloat(match[1], 64)
+	if err != nil {
+		return nil, fmt.Errorf("%q has an invalid value", item)
+	}
+
+	p := &Perfdata{
+		Label: label,
+		Value: value * unit.multiplier,
+		Unit:  unit.unit,
+	}
+
+	thresholds := []*string{&p.Warn, &p.Crit, &p.Min, &p.Max}
+	for i, field := range fields[1:] {
+		if i >= len(thresholds) {
+			break
+		}
+		*thresholds[i] = field
+	}
+
+	return p, nil
+}
@@ -0,0 +1,65 @@
+package parse_statusdat
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Block is a single object of status.dat, e.g `hoststatus {` with its `key=value` lines as Fields
+type Block struct {
+	Type   string
+	Fields map[string]string
+}
+
+// plugin output is kept on a single line but can be far longer than the default 64KB token limit of bufio.Scanner
+const maxLineLength = 16 * 1024 * 1024
+
+// Parse reads every object block of the status.dat file Nagios Core writes every status_update_interval
+// https://assets.nagios.com/downloads/nagioscore/docs/nagioscore/4/en/configmain.html#status_file
+func Parse(r io.Reader) ([]Block, error) {
+	var blocks []Block
+	var block *Block
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineLength)
+
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+			continue
+		// `plugin_output=... {` is a field ending in a brace, block openers have no `=`
+		case strings.HasSuffix(line, "{") && !strings.Contains(line, "="):
+			if block != nil {
+				return nil, fmt.Errorf("line %d: %s block opened inside %s block", lineNumber, line, block.Type)
+			}
+			block = &Block{Type: strings.TrimSpace(strings.TrimSuffix(line, "{")), Fields: map[string]string{}}
+		case line == "}":
+			if block == nil {
+				return nil, fmt.Errorf("line %d: closing a block that isn't open", lineNumber)
+			}
+			blocks = append(blocks, *block)
+			block = nil
+		default:
+			if block == nil {
+				return nil, fmt.Errorf("line %d: %q outside of a block", lineNumber, line)
+			}
+			// only split on the first `=`, plugin output and perfdata contain them too
+			key, value, _ := strings.Cut(line, "=")
+			block.Fields[key] = value
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if block != nil {
+		return nil, fmt.Errorf("%s block is never closed", block.Type)
+	}
+
+	return blocks, nil
+}
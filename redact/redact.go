@@ -0,0 +1,85 @@
+package redact
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Hook scrubs API keys and passwords from every log entry, required as the Nagios XI API only supports giving
+// the API token as a URL parameter, and thus can be leaked in the logs. It fires before the entry reaches any
+// formatter, so text and JSON output are both redacted
+// https://github.com/sirupsen/logrus#hooks
+type Hook struct {
+	// guards the secrets, which are swapped by a SIGHUP configuration reload
+	mutex sync.RWMutex
+	// the main API key plus any `?target=` and instance API keys
+	apiKeys []string
+	// basic auth passwords
+	passwords []string
+	// the secrets before the last reload
+	previousAPIKeys, previousPasswords []string
+}
+
+// SetSecrets replaces the secrets on a configuration reload, so they don't pile up. The replaced ones stay redacted
+// until the following reload, log lines from scrapes that started before it may still contain them
+func (h *Hook) SetSecrets(apiKeys []string, password string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.previousAPIKeys, h.previousPasswords = h.apiKeys, h.passwords
+	h.apiKeys, h.passwords = apiKeys, []string{password}
+}
+
+func (h *Hook) Levels() []log.Level {
+	return log.AllLevels
+}
+
+func (h *Hook) Fire(entry *log.Entry) error {
+	entry.Message = h.Redact(entry.Message)
+
+	// fields like log.WithError() aren't always strings, so redact their string form
+	for key, value := range entry.Data {
+		switch value := value.(type) {
+		case string:
+			entry.Data[key] = h.Redact(value)
+		case error:
+			entry.Data[key] = h.Redact(value.Error())
+		case fmt.Stringer:
+			entry.Data[key] = h.Redact(value.String())
+		}
+	}
+
+	return nil
+}
+
+// Redact replaces every secret in message, including API keys escaped as a URL parameter like `a%2Bb` for `a+b`
+func (h *Hook) Redact(message string) string {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	for _, apiKeys := range [][]string{h.apiKeys, h.previousAPIKeys} {
+		for _, apiKey := range apiKeys {
+			// an empty key would otherwise "redact" every character
+			if apiKey == "" {
+				continue
+			}
+			message = strings.ReplaceAll(message, apiKey, "<redactedAPIKey>")
+			message = strings.ReplaceAll(message, url.QueryEscape(apiKey), "<redactedAPIKey>")
+		}
+	}
+
+	for _, passwords := range [][]string{h.passwords, h.previousPasswords} {
+		for _, password := range passwords {
+			if password == "" {
+				continue
+			}
+			message = strings.ReplaceAll(message, password, "<redactedPassword>")
+		}
+	}
+
+	return message
+}
@@ -0,0 +1,283 @@
+package status_counts
+
+import "strconv"
+
+// Service is the part of a service's status that's counted, the json tags match the Nagios XI servicestatus API
+// which gives every number as a string
+type Service struct {
+	// 0 active, 1 passive
+	CheckType float64 `json:"check_type,string"`
+	// 0 ok, 1 warning, 2 critical, 3 unknown
+	CurrentState float64 `json:"current_state,string"`
+	// 0 soft, 1 hard
+	StateType                  float64 `json:"state_type,string"`
+	IsFlapping                 float64 `json:"is_flapping,string"`
+	ScheduledDowntimeDepth     float64 `json:"scheduled_downtime_depth,string"`
+	ProblemHasBeenAcknowledged float64 `json:"problem_has_been_acknowledged,string"`
+	NotificationsEnabled       float64 `json:"notifications_enabled,string"`
+	ActiveChecksEnabled        float64 `json:"active_checks_enabled,string"`
+	// 1 when Nagios will run active checks, i.e active checks are enabled and the service has a check_interval
+	ShouldBeScheduled float64 `json:"should_be_scheduled,string"`
+	// a soft state is rechecked until current_attempt reaches max_attempts, when it becomes hard
+	CurrentAttempt float64 `json:"current_attempt,string"`
+	MaxAttempts    float64 `json:"max_attempts,string"`
+}
+
+// Host is the part of a host's status that's counted, like Service
+type Host struct {
+	// 0 active, 1 passive
+	CheckType float64 `json:"check_type,string"`
+	// 0 up, 1 down, 2 unreachable
+	CurrentState float64 `json:"current_state,string"`
+	// 0 soft, 1 hard
+	StateType                  float64 `json:"state_type,string"`
+	IsFlapping                 float64 `json:"is_flapping,string"`
+	ScheduledDowntimeDepth     float64 `json:"scheduled_downtime_depth,string"`
+	ProblemHasBeenAcknowledged float64 `json:"problem_has_been_acknowledged,string"`
+	NotificationsEnabled       float64 `json:"notifications_enabled,string"`
+	ActiveChecksEnabled        float64 `json:"active_checks_enabled,string"`
+	CurrentAttempt             float64 `json:"current_attempt,string"`
+	MaxAttempts                float64 `json:"max_attempts,string"`
+}
+
+// status.dat values are all strings, a missing or unparsable field counts as 0
+// Nagios Core's status.dat uses the same field names and numbers as the Nagios XI API
+func statusFileField(fields map[string]string, field string) float64 {
+	value, _ := strconv.ParseFloat(fields[field], 64)
+	return value
+}
+
+// ServiceFromStatusFile is the counted part of a status.dat servicestatus block
+func ServiceFromStatusFile(fields map[string]string) Service {
+	return Service{
+		CheckType:                  statusFileField(fields, "check_type"),
+		CurrentState:               statusFileField(fields, "current_state"),
+		StateType:                  statusFileField(fields, "state_type"),
+		IsFlapping:                 statusFileField(fields, "is_flapping"),
+		ScheduledDowntimeDepth:     statusFileField(fields, "scheduled_downtime_depth"),
+		ProblemHasBeenAcknowledged: statusFileField(fields, "problem_has_been_acknowledged"),
+		NotificationsEnabled:       statusFileField(fields, "notifications_enabled"),
+		ActiveChecksEnabled:        statusFileField(fields, "active_checks_enabled"),
+		ShouldBeScheduled:          statusFileField(fields, "should_be_scheduled"),
+		CurrentAttempt:             statusFileField(fields, "current_attempt"),
+		MaxAttempts:                statusFileField(fields, "max_attempts"),
+	}
+}
+
+// HostFromStatusFile is the counted part of a status.dat hoststatus block
+func HostFromStatusFile(fields map[string]string) Host {
+	return Host{
+		CheckType:                  statusFileField(fields, "check_type"),
+		CurrentState:               statusFileField(fields, "current_state"),
+		StateType:                  statusFileField(fields, "state_type"),
+		IsFlapping:                 statusFileField(fields, "is_flapping"),
+		ScheduledDowntimeDepth:     statusFileField(fields, "scheduled_downtime_depth"),
+		ProblemHasBeenAcknowledged: statusFileField(fields, "problem_has_been_acknowledged"),
+		NotificationsEnabled:       statusFileField(fields, "notifications_enabled"),
+		ActiveChecksEnabled:        statusFileField(fields, "active_checks_enabled"),
+		CurrentAttempt:             statusFileField(fields, "current_attempt"),
+		MaxAttempts:                statusFileField(fields, "max_attempts"),
+	}
+}
+
+// ServiceCounts are the totals behind the nagios_services_* metrics
+type ServiceCounts struct {
+	Total, Active, Passive                                                      float64
+	Ok, Warn, Critical, Unknown, Pending                                        float64
+	HardOk, HardWarn, HardCritical, HardUnknown                                 float64
+	AcknowledgedOk, AcknowledgedWarn, AcknowledgedCritical, AcknowledgedUnknown float64
+	Flapping, Downtime, NotificationsDisabled, ChecksDisabled, Scheduled        float64
+	Retrying                                                                    float64
+}
+
+// HostCounts are the totals behind the nagios_hosts_* metrics
+type HostCounts struct {
+	Total, Active, Passive                                    float64
+	Up, Down, Unreachable, Pending                            float64
+	HardUp, HardDown, HardUnreachable                         float64
+	AcknowledgedUp, AcknowledgedDown, AcknowledgedUnreachable float64
+	Flapping, Downtime, NotificationsDisabled, ChecksDisabled float64
+	Retrying                                                  float64
+}
+
+// CheckType is the check_type label of a host or service, every check_type but 0 is a passive check
+func CheckType(checkType float64) string {
+	if checkType == 0 {
+		return "active"
+	}
+	return "passive"
+}
+
+// ServiceState is the status label of a current_state, pending for states Nagios doesn't define
+// so every service is counted in one state
+func ServiceState(currentState float64) string {
+	switch currentState {
+	case 0:
+		return "ok"
+	case 1:
+		return "warn"
+	case 2:
+		return "critical"
+	case 3:
+		return "unknown"
+	}
+	return "pending"
+}
+
+// HostState is the status label of a host's current_state, pending for states Nagios doesn't define
+func HostState(currentState float64) string {
+	switch currentState {
+	case 0:
+		return "up"
+	case 1:
+		return "down"
+	case 2:
+		return "unreachable"
+	}
+	return "pending"
+}
+
+// Retrying is true for a host or service in a soft state past its first check attempt, i.e a problem Nagios is
+// rechecking that becomes a hard state, and usually a notification, if it persists until max_attempts
+func Retrying(stateType, currentAttempt float64) bool {
+	return stateType == 0 && currentAttempt > 1
+}
+
+// Add counts a service towards every total it belongs to
+func (c *ServiceCounts) Add(s Service) {
+	c.Total++
+
+	if CheckType(s.CheckType) == "active" {
+		c.Active++
+	} else {
+		c.Passive++
+	}
+
+	hardState := s.StateType == 1
+	acknowledged := s.ProblemHasBeenAcknowledged == 1
+
+	switch ServiceState(s.CurrentState) {
+	case "ok":
+		c.Ok++
+		if hardState {
+			c.HardOk++
+		}
+		if acknowledged {
+			c.AcknowledgedOk++
+		}
+	case "warn":
+		c.Warn++
+		if hardState {
+			c.HardWarn++
+		}
+		if acknowledged {
+			c.AcknowledgedWarn++
+		}
+	case "critical":
+		c.Critical++
+		if hardState {
+			c.HardCritical++
+		}
+		if acknowledged {
+			c.AcknowledgedCritical++
+		}
+	case "unknown":
+		c.Unknown++
+		if hardState {
+			c.HardUnknown++
+		}
+		if acknowledged {
+			c.AcknowledgedUnknown++
+		}
+	case "pending":
+		c.Pending++
+	}
+
+	if s.IsFlapping == 1 {
+		c.Flapping++
+	}
+
+	if s.ScheduledDowntimeDepth == 1 {
+		c.Downtime++
+	}
+
+	if s.NotificationsEnabled == 0 {
+		c.NotificationsDisabled++
+	}
+
+	if s.ActiveChecksEnabled == 0 {
+		c.ChecksDisabled++
+	}
+
+	// a passive-only service with active checks enabled but no check_interval is neither scheduled nor disabled
+	if s.ShouldBeScheduled == 1 {
+		c.Scheduled++
+	}
+
+	if Retrying(s.StateType, s.CurrentAttempt) {
+		c.Retrying++
+	}
+}
+
+// Add counts a host towards every total it belongs to
+func (c *HostCounts) Add(h Host) {
+	c.Total++
+
+	if CheckType(h.CheckType) == "active" {
+		c.Active++
+	} else {
+		c.Passive++
+	}
+
+	hardState := h.StateType == 1
+	acknowledged := h.ProblemHasBeenAcknowledged == 1
+
+	switch HostState(h.CurrentState) {
+	case "up":
+		c.Up++
+		if hardState {
+			c.HardUp++
+		}
+		if acknowledged {
+			c.AcknowledgedUp++
+		}
+	case "down":
+		c.Down++
+		if hardState {
+			c.HardDown++
+		}
+		if acknowledged {
+			c.AcknowledgedDown++
+		}
+	case "unreachable":
+		c.Unreachable++
+		if hardState {
+			c.HardUnreachable++
+		}
+		if acknowledged {
+			c.AcknowledgedUnreachable++
+		}
+	case "pending":
+		c.Pending++
+	}
+
+	if h.IsFlapping == 1 {
+		c.Flapping++
+	}
+
+	if h.ScheduledDowntimeDepth == 1 {
+		c.Downtime++
+	}
+
+	if h.NotificationsEnabled == 0 {
+		c.NotificationsDisabled++
+	}
+
+	if h.ActiveChecksEnabled == 0 {
+		c.ChecksDisabled++
+	}
+
+	if Retrying(h.StateType, h.CurrentAttempt) {
+		c.Retrying++
+	}
+}
@@ -1,9 +1,11 @@
 package test
 
 import (
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/linode-obs/nagios_exporter/get_nagios_version"
@@ -49,7 +51,7 @@ func TestGetStringFromWebpage(t *testing.T) {
 	defer testServer.Close()
 
 	// Call the function with the URL of the test server
-	result, err := get_nagios_version.GetLatestNagiosXIVersion(testServer.URL)
+	result, err := get_nagios_version.GetLatestNagiosXIVersion(testServer.Client(), testServer.URL)
 	if err != nil {
 		t.Errorf("Unexpected error: %v", err)
 	}
@@ -60,3 +62,63 @@ func TestGetStringFromWebpage(t *testing.T) {
 		t.Errorf("Expected %q, but got %q", expected, result)
 	}
 }
+
+func TestGetLatestNagiosXIVersionNotFound(t *testing.T) {
+	// the versions page still loads, but no longer lists the versions as text starting with `xi-`
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := w.Write([]byte(`<!DOCTYPE html>
+		<html>
+		<head><title>Nagios XI &middot; Previous Versions</title></head>
+		<body><h1>Nagios XI - Previous Versions</h1><p>Downloads have moved to our new customer portal.</p></body>
+		</html>`))
+		if err != nil {
+			log.Fatal(err)
+		}
+	}))
+	defer testServer.Close()
+
+	result, err := get_nagios_version.GetLatestNagiosXIVersion(testServer.Client(), testServer.URL)
+	if !errors.Is(err, get_nagios_version.ErrVersionNotFound) {
+		t.Errorf("Expected ErrVersionNotFound, but got %v", err)
+	}
+	if result != "" {
+		t.Errorf("Expected no version, but got %q", result)
+	}
+}
+
+func TestGetLatestNagiosXIVersionErrorStatus(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+	}))
+	defer testServer.Close()
+
+	_, err := get_nagios_version.GetLatestNagiosXIVersion(testServer.Client(), testServer.URL)
+	if err == nil {
+		t.Fatal("Expected an error, but got none")
+	}
+	if errors.Is(err, get_nagios_version.ErrVersionNotFound) {
+		t.Errorf("Expected the status in the error, but got %v", err)
+	}
+}
+
+func TestGetLatestNagiosXIVersionTimeout(t *testing.T) {
+	done := make(chan struct{})
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer testServer.Close()
+	// unblock the handler before Close waits on it
+	defer close(done)
+
+	client := testServer.Client()
+	client.Timeout = 50 * time.Millisecond
+
+	start := time.Now()
+	_, err := get_nagios_version.GetLatestNagiosXIVersion(client, testServer.URL)
+	if err == nil {
+		t.Fatal("Expected a timeout error, but got none")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the request to time out after 50ms, but it took %v", elapsed)
+	}
+}
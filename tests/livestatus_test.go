@@ -0,0 +1,98 @@
+package test
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/linode-obs/nagios_exporter/livestatus"
+)
+
+// serve a single canned livestatus response on a unix socket, returning the query it received
+func fakeLivestatus(t *testing.T, status int, body string) (string, chan string) {
+	socket := filepath.Join(t.TempDir(), "live")
+
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("Failed to listen on %s: %v", socket, err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	queries := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		// a query ends with an empty line
+		var query strings.Builder
+		reader := bufio.NewReader(conn)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil || line == "\n" {
+				break
+			}
+			query.WriteString(line)
+		}
+		queries <- query.String()
+
+		fmt.Fprintf(conn, "%03d %11d\n%s", status, len(body), body)
+	}()
+
+	return socket, queries
+}
+
+func TestLivestatusQueryStats(t *testing.T) {
+	socket, queries := fakeLivestatus(t, 200, "[[3,2,1]]\n")
+
+	stats, err := livestatus.QueryStats(socket, time.Second, "GET hosts\nStats: state >= 0\nStats: check_type = 0\nStats: check_type = 1")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []float64{3, 2, 1}
+	if !reflect.DeepEqual(stats, expected) {
+		t.Errorf("Expected %v, but got %v", expected, stats)
+	}
+
+	query := <-queries
+	for _, header := range []string{"GET hosts\n", "OutputFormat: json\n", "ResponseHeader: fixed16\n"} {
+		if !strings.Contains(query, header) {
+			t.Errorf("Expected query to contain %q, but got %q", header, query)
+		}
+	}
+}
+
+func TestLivestatusQuery(t *testing.T) {
+	socket, _ := fakeLivestatus(t, 200, `[["linux-servers",2],["databases",1]]`)
+
+	rows, err := livestatus.Query(socket, time.Second, "GET hostgroups\nColumns: name num_hosts")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := [][]interface{}{{"linux-servers", float64(2)}, {"databases", float64(1)}}
+	if !reflect.DeepEqual(rows, expected) {
+		t.Errorf("Expected %v, but got %v", expected, rows)
+	}
+}
+
+func TestLivestatusQueryError(t *testing.T) {
+	socket, _ := fakeLivestatus(t, 400, "Invalid GET request, no such table 'hots'\n")
+
+	_, err := livestatus.Query(socket, time.Second, "GET hots")
+	if err == nil {
+		t.Fatal("Expected an error, but got none")
+	}
+
+	if !strings.Contains(err.Error(), "no such table") {
+		t.Errorf("Expected the livestatus error message, but got %v", err)
+	}
+}
@@ -0,0 +1,117 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/linode-obs/nagios_exporter/parse_api_response"
+)
+
+// what Nagios XI serves instead of JSON when the session expired or the API key is wrong
+const loginPage = `<!DOCTYPE html>
+<html>
+<head>
+	<title>Login &middot; Nagios XI</title>
+</head>
+<body>
+	<form method="post" action="/nagiosxi/login.php">
+</body>
+</html>`
+
+func TestCheckContentType(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		expectError bool
+	}{
+		{"json", "application/json", `{"is_currently_running": "1"}`, false},
+		{"json with charset", "application/json; charset=utf-8", `{"is_currently_running": "1"}`, false},
+		{"json labelled html", "text/html; charset=UTF-8", `{"is_currently_running": "1"}`, false},
+		{"json array", "application/json", `[]`, false},
+		{"html login page", "text/html; charset=UTF-8", loginPage, true},
+		{"html without content type", "", loginPage, true},
+		{"empty body", "text/html", "", true},
+	}
+
+	for _, test := range tests {
+		err := parse_api_response.CheckContentType(test.contentType, []byte(test.body))
+		if test.expectError && err == nil {
+			t.Errorf("%s: Expected an error, but got none", test.name)
+		}
+		if !test.expectError && err != nil {
+			t.Errorf("%s: Unexpected error: %v", test.name, err)
+		}
+	}
+}
+
+func TestUnmarshalHTML(t *testing.T) {
+	defer func() {
+		if r := recover(); r != nil {
+			t.Fatalf("Expected an error, but parsing panicked: %v", r)
+		}
+	}()
+
+	var systemStatus struct {
+		Running float64 `json:"is_currently_running,string"`
+	}
+	err := parse_api_response.Unmarshal([]byte(loginPage), &systemStatus)
+	if err == nil {
+		t.Fatal("Expected an error, but got none")
+	}
+
+	// the error shows what Nagios sent instead of JSON
+	if !strings.Contains(err.Error(), "Login &middot; Nagios XI") {
+		t.Errorf("Expected the error to quote the login page, but got %v", err)
+	}
+}
+
+// a wrong API key is answered with valid JSON under a 200, which would unmarshal into an empty response
+func TestAPIErrorInvalidAPIKey(t *testing.T) {
+	body := []byte(`{"error":"Invalid API Key"}`)
+
+	var systemStatus struct {
+		Running float64 `json:"is_currently_running,string"`
+	}
+	if err := parse_api_response.Unmarshal(body, &systemStatus); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	err := parse_api_response.APIError(body)
+	if err == nil {
+		t.Fatal("Expected an error, but got none")
+	}
+	if !strings.Contains(err.Error(), "Invalid API Key") {
+		t.Errorf("Expected the error to quote Nagios, but got %v", err)
+	}
+}
+
+func TestAPIError(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"response", `{"is_currently_running": "1"}`},
+		{"empty error", `{"error": "", "recordcount": "0"}`},
+		{"array", `[{"error": "Invalid API Key"}]`},
+	}
+
+	for _, test := range tests {
+		if err := parse_api_response.APIError([]byte(test.body)); err != nil {
+			t.Errorf("%s: Unexpected error: %v", test.name, err)
+		}
+	}
+}
+
+func TestUnmarshal(t *testing.T) {
+	var systemStatus struct {
+		Running float64 `json:"is_currently_running,string"`
+	}
+	if err := parse_api_response.Unmarshal([]byte(`{"is_currently_running": "1"}`), &systemStatus); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if systemStatus.Running != 1 {
+		t.Errorf("Expected is_currently_running 1, but got %v", systemStatus.Running)
+	}
+}
@@ -0,0 +1,92 @@
+package test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/linode-obs/nagios_exporter/parse_nagiostats"
+)
+
+// the exporter looks nagiostats values up by name, so a variable added in the middle of the list
+// must not shift the values of the variables after it
+func TestParseMRTG(t *testing.T) {
+	expected := []string{
+		"NAGIOSVERSION",
+		"NUMHOSTS", "NUMHSTACTCHK60M", "NUMHSTPSVCHK60M", "NUMHSTUP", "NUMHSTDOWN", "NUMHSTUNR", "NUMHSTFLAPPING", "NUMHSTDOWNTIME",
+		"NUMSERVICES", "NUMSVCACTCHK60M", "NUMSVCPSVCHK60M", "NUMSVCOK", "NUMSVCWARN", "NUMSVCUNKN", "NUMSVCCRIT", "NUMSVCFLAPPING", "NUMSVCDOWNTIME",
+		"NUMHSTACTCHK1M", "NUMHSTACTCHK5M", "NUMHSTACTCHK15M", "NUMHSTPSVCHK1M", "NUMHSTPSVCHK5M", "NUMHSTPSVCHK15M",
+		"NUMSVCACTCHK1M", "NUMSVCACTCHK5M", "NUMSVCACTCHK15M", "NUMSVCPSVCHK1M", "NUMSVCPSVCHK5M", "NUMSVCPSVCHK15M",
+		"AVGACTHSTLAT", "MINACTHSTLAT", "MAXACTHSTLAT", "AVGACTHSTEXT", "MINACTHSTEXT", "MAXACTHSTEXT",
+		"AVGACTSVCLAT", "MINACTSVCLAT", "MAXACTSVCLAT", "AVGACTSVCEXT", "MINACTSVCEXT", "MAXACTSVCEXT",
+		"AVGPSVHSTLAT", "MINPSVHSTLAT", "MAXPSVHSTLAT", "AVGPSVSVCLAT", "MINPSVSVCLAT", "MAXPSVSVCLAT",
+	}
+
+	requested := make(map[string]bool, len(parse_nagiostats.MRTGVariables))
+	for _, variable := range parse_nagiostats.MRTGVariables {
+		requested[variable] = true
+	}
+	for _, variable := range expected {
+		if !requested[variable] {
+			t.Errorf("Expected %s to be requested from nagiostats", variable)
+		}
+	}
+
+	// nagiostats prints the values in the order they were requested, make each one unique
+	values := make([]string, 0, len(parse_nagiostats.MRTGVariables))
+	for i := range parse_nagiostats.MRTGVariables {
+		values = append(values, fmt.Sprint(i))
+	}
+
+	stats, err := parse_nagiostats.ParseMRTG(strings.Join(values, ",") + "\n")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for index, variable := range parse_nagiostats.MRTGVariables {
+		if stats[variable] != fmt.Sprint(index) {
+			t.Errorf("Expected %s to be %d, but got %q", variable, index, stats[variable])
+		}
+	}
+}
+
+func TestParseMRTGTooFewValues(t *testing.T) {
+	// e.g nagiostats failing to read status.dat only prints some of the values
+	_, err := parse_nagiostats.ParseMRTG("4.4.6,10,5\n")
+	if err == nil {
+		t.Fatal("Expected an error, but got none")
+	}
+}
+
+func TestValue(t *testing.T) {
+	stats := map[string]string{"NUMHOSTS": "12", "MINPSVSVCLAT": "", "NUMSVCCRIT": "3"}
+
+	tests := []struct {
+		variable string
+		expected float64
+	}{
+		{"NUMHOSTS", 12},
+		{"NUMSVCCRIT", 3},
+		// e.g no passive checks run yet
+		{"MINPSVSVCLAT", 0},
+	}
+
+	for _, test := range tests {
+		value, err := parse_nagiostats.Value(stats, test.variable)
+		if err != nil {
+			t.Errorf("%s: Unexpected error: %v", test.variable, err)
+		}
+		if value != test.expected {
+			t.Errorf("%s: Expected %v, but got %v", test.variable, test.expected, value)
+		}
+	}
+}
+
+// a misspelled or unrequested variable must not silently read as 0
+func TestValueUnknownVariable(t *testing.T) {
+	stats := map[string]string{"NUMSVCCRIT": "3"}
+
+	if _, err := parse_nagiostats.Value(stats, "NUMSVCCHKCRIT"); err == nil {
+		t.Fatal("Expected an error, but got none")
+	}
+}
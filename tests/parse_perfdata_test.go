@@ -0,0 +1,102 @@
+package test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/linode-obs/nagios_exporter/parse_perfdata"
+)
+
+func TestParsePerfdata(t *testing.T) {
+	tests := []struct {
+		name        string
+		perfdata    string
+		expected    []parse_perfdata.Perfdata
+		expectError bool
+	}{
+		{
+			name:     "thresholds without unit",
+			perfdata: "load1=0.5;1.0;2.0",
+			expected: []parse_perfdata.Perfdata{
+				{Label: "load1", Value: 0.5, Warn: "1.0", Crit: "2.0"},
+			},
+		},
+		{
+			name:     "multiple items with units",
+			perfdata: "time=150ms;1;2;0 size=2KB;;;0 pl=10%;20;60;0;100",
+			expected: []parse_perfdata.Perfdata{
+				{Label: "time", Value: 0.15, Unit: "seconds", Warn: "1", Crit: "2", Min: "0"},
+				{Label: "size", Value: 2048, Unit: "bytes", Min: "0"},
+				{Label: "pl", Value: 10, Unit: "percent", Warn: "20", Crit: "60", Min: "0", Max: "100"},
+			},
+		},
+		{
+			name:     "quoted label with spaces and range thresholds",
+			perfdata: "'free space'=20.5GB;@10:20;~:5 'it''s'=1c",
+			expected: []parse_perfdata.Perfdata{
+				{Label: "free space", Value: 20.5 * 1024 * 1024 * 1024, Unit: "bytes", Warn: "@10:20", Crit: "~:5"},
+				{Label: "it's", Value: 1, Unit: "counter"},
+			},
+		},
+		{
+			name:     "negative and exponent values",
+			perfdata: "offset=-0.003s temp=1.5e2",
+			expected: []parse_perfdata.Perfdata{
+				{Label: "offset", Value: -0.003, Unit: "seconds"},
+				{Label: "temp", Value: 150},
+			},
+		},
+		{
+			name:     "unknown value is skipped",
+			perfdata: "rta=U;;; pl=0%",
+			expected: []parse_perfdata.Perfdata{
+				{Label: "pl", Value: 0, Unit: "percent"},
+			},
+		},
+		{
+			name:     "empty",
+			perfdata: "",
+			expected: nil,
+		},
+		{
+			name:        "malformed item does not drop the others",
+			perfdata:    "garbage load1=0.5 bad=abc weird=1parsecs",
+			expected:    []parse_perfdata.Perfdata{{Label: "load1", Value: 0.5}},
+			expectError: true,
+		},
+		{
+			name:        "missing label",
+			perfdata:    "=5",
+			expected:    nil,
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := parse_perfdata.ParsePerfdata(tt.perfdata)
+			if tt.expectError && err == nil {
+				t.Errorf("Expected an error parsing %q, but got none", tt.perfdata)
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+
+			if len(result) != len(tt.expected) {
+				t.Fatalf("Expected %d perfdata items, but got %d: %+v", len(tt.expected), len(result), result)
+			}
+
+			for i := range tt.expected {
+				expected, got := tt.expected[i], result[i]
+				// avoid comparing floats exactly after unit conversion
+				if diff := expected.Value - got.Value; diff > 1e-9 || diff < -1e-9 {
+					t.Errorf("Expected value %v for %q, but got %v", expected.Value, expected.Label, got.Value)
+				}
+				expected.Value, got.Value = 0, 0
+				if !reflect.DeepEqual(expected, got) {
+					t.Errorf("Expected %+v, but got %+v", expected, got)
+				}
+			}
+		})
+	}
+}
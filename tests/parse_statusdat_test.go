@@ -0,0 +1,132 @@
+package test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/linode-obs/nagios_exporter/parse_statusdat"
+)
+
+// trimmed down from a Nagios Core 4.4 status.dat, the real one has dozens of fields per block
+const statusDat = `########################################
+#          NAGIOS STATUS FILE
+#
+# THIS FILE IS AUTOMATICALLY GENERATED
+# BY NAGIOS.  DO NOT MODIFY THIS FILE!
+########################################
+
+info {
+	created=1760436000
+	version=4.4.6
+	}
+
+hoststatus {
+	host_name=web01
+	check_type=0
+	current_state=0
+	state_type=1
+	plugin_output=PING OK - Packet loss = 0%, RTA = 0.05 ms
+	performance_data=rta=0.050000ms;3000.000000;5000.000000;0.000000 pl=0%;80;100;0
+	}
+
+servicestatus {
+	host_name=web01
+	service_description=HTTP
+	current_state=2
+	long_plugin_output=
+	}
+`
+
+func TestParseStatusDat(t *testing.T) {
+	blocks, err := parse_statusdat.Parse(strings.NewReader(statusDat))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []parse_statusdat.Block{
+		{Type: "info", Fields: map[string]string{"created": "1760436000", "version": "4.4.6"}},
+		{Type: "hoststatus", Fields: map[string]string{
+			"host_name":     "web01",
+			"check_type":    "0",
+			"current_state": "0",
+			"state_type":    "1",
+			// only the first `=` separates the key from the value
+			"plugin_output":    "PING OK - Packet loss = 0%, RTA = 0.05 ms",
+			"performance_data": "rta=0.050000ms;3000.000000;5000.000000;0.000000 pl=0%;80;100;0",
+		}},
+		{Type: "servicestatus", Fields: map[string]string{
+			"host_name":           "web01",
+			"service_description": "HTTP",
+			"current_state":       "2",
+			"long_plugin_output":  "",
+		}},
+	}
+
+	if !reflect.DeepEqual(blocks, expected) {
+		t.Errorf("Expected %v, but got %v", expected, blocks)
+	}
+}
+
+// plugins are free to print braces, e.g JSON or a shell snippet, at the end of their output
+func TestParseStatusDatBraceTerminatedValue(t *testing.T) {
+	statusDat := `servicestatus {
+	host_name=web01
+	service_description=API
+	plugin_output=CRITICAL - unexpected response {
+	long_plugin_output={"status": "down", "checks": {
+	current_state=2
+	}
+`
+
+	blocks, err := parse_statusdat.Parse(strings.NewReader(statusDat))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []parse_statusdat.Block{
+		{Type: "servicestatus", Fields: map[string]string{
+			"host_name":           "web01",
+			"service_description": "API",
+			"plugin_output":       "CRITICAL - unexpected response {",
+			"long_plugin_output":  `{"status": "down", "checks": {`,
+			"current_state":       "2",
+		}},
+	}
+
+	if !reflect.DeepEqual(blocks, expected) {
+		t.Errorf("Expected %v, but got %v", expected, blocks)
+	}
+}
+
+func TestParseStatusDatErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		statusDat string
+	}{
+		{
+			name:      "unclosed block, e.g a truncated file",
+			statusDat: "hoststatus {\n\thost_name=web01\n",
+		},
+		{
+			name:      "nested block",
+			statusDat: "hoststatus {\nservicestatus {\n}\n}\n",
+		},
+		{
+			name:      "field outside of a block",
+			statusDat: "host_name=web01\n",
+		},
+		{
+			name:      "closing a block that isn't open",
+			statusDat: "}\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := parse_statusdat.Parse(strings.NewReader(test.statusDat)); err == nil {
+				t.Error("Expected an error, but got none")
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/linode-obs/nagios_exporter/redact"
+	log "github.com/sirupsen/logrus"
+)
+
+// logs through a logger of its own so the hook isn't left on the standard logger
+func logRedacted(formatter log.Formatter, hook *redact.Hook, logLine func(logger *log.Logger)) string {
+	var output bytes.Buffer
+	logger := log.New()
+	logger.SetOutput(&output)
+	logger.SetFormatter(formatter)
+	logger.AddHook(hook)
+
+	logLine(logger)
+
+	return output.String()
+}
+
+func TestRedactFormatters(t *testing.T) {
+	hook := &redact.Hook{}
+	hook.SetSecrets([]string{"mainkey", "targetkey"}, "hunter2")
+
+	formatters := map[string]log.Formatter{
+		"text": &log.TextFormatter{DisableColors: true},
+		"json": &log.JSONFormatter{},
+	}
+
+	for name, formatter := range formatters {
+		output := logRedacted(formatter, hook, func(logger *log.Logger) {
+			logger.Warn("Failed to query http://nagios/api?apikey=mainkey as nagiosadmin:hunter2")
+		})
+
+		for _, secret := range []string{"mainkey", "hunter2"} {
+			if strings.Contains(output, secret) {
+				t.Errorf("%s: Expected %s to be redacted, but got %s", name, secret, output)
+			}
+		}
+		// the JSON formatter escapes the angle brackets
+		if !strings.Contains(output, "redactedAPIKey") || !strings.Contains(output, "redactedPassword") {
+			t.Errorf("%s: Expected the secrets to be replaced, but got %s", name, output)
+		}
+	}
+}
+
+func TestRedactFields(t *testing.T) {
+	hook := &redact.Hook{}
+	hook.SetSecrets([]string{"targetkey"}, "")
+
+	output := logRedacted(&log.JSONFormatter{}, hook, func(logger *log.Logger) {
+		logger.WithField("target", "http://nagios2/?apikey=targetkey").WithError(errors.New("dial tcp: apikey targetkey refused")).Error("Scrape failed")
+	})
+
+	var entry map[string]string
+	if err := json.Unmarshal([]byte(output), &entry); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if entry["target"] != "http://nagios2/?apikey=<redactedAPIKey>" {
+		t.Errorf("Expected the target field to be redacted, but got %q", entry["target"])
+	}
+	// errors are redacted in their string form
+	if entry["error"] != "dial tcp: apikey <redactedAPIKey> refused" {
+		t.Errorf("Expected the error field to be redacted, but got %q", entry["error"])
+	}
+}
+
+// a key with characters like + or / appears escaped in the URLs quoted by request errors
+func TestRedactURLEscapedAPIKey(t *testing.T) {
+	hook := &redact.Hook{}
+	hook.SetSecrets([]string{"a+b/c=="}, "")
+
+	redacted := hook.Redact(`Get "http://nagios/api?apikey=a%2Bb%2Fc%3D%3D": timeout, key a+b/c==`)
+	if redacted != `Get "http://nagios/api?apikey=<redactedAPIKey>": timeout, key <redactedAPIKey>` {
+		t.Errorf("Expected both forms of the API key to be redacted, but got %s", redacted)
+	}
+}
+
+// a reload replaces the secrets, only those of the configuration before it are still redacted
+func TestRedactSetSecretsReplaces(t *testing.T) {
+	hook := &redact.Hook{}
+	hook.SetSecrets([]string{"firstkey"}, "firstpass")
+	hook.SetSecrets([]string{"secondkey"}, "secondpass")
+	hook.SetSecrets([]string{"thirdkey"}, "thirdpass")
+
+	redacted := hook.Redact("firstkey firstpass secondkey secondpass thirdkey thirdpass")
+	expected := "firstkey firstpass <redactedAPIKey> <redactedPassword> <redactedAPIKey> <redactedPassword>"
+	if redacted != expected {
+		t.Errorf("Expected %s, but got %s", expected, redacted)
+	}
+}
+
+// an empty secret, e.g no basic auth password, must not replace every character
+func TestRedactEmptySecrets(t *testing.T) {
+	hook := &redact.Hook{}
+	hook.SetSecrets([]string{""}, "")
+
+	if redacted := hook.Redact("nothing secret"); redacted != "nothing secret" {
+		t.Errorf("Expected the message to be left alone, but got %s", redacted)
+	}
+}
@@ -0,0 +1,343 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/linode-obs/nagios_exporter/parse_statusdat"
+	"github.com/linode-obs/nagios_exporter/status_counts"
+)
+
+// a Nagios XI servicestatus response with one service per interesting combination, trimmed to the counted fields
+const serviceStatusJSON = `{
+	"recordcount": "7",
+	"servicestatus": [
+		{"check_type": "0", "current_state": "0", "state_type": "1", "is_flapping": "0", "scheduled_downtime_depth": "0", "problem_has_been_acknowledged": "0", "notifications_enabled": "1", "active_checks_enabled": "1", "current_attempt": "1", "max_attempts": "3", "should_be_scheduled": "1"},
+		{"check_type": "0", "current_state": "1", "state_type": "0", "is_flapping": "1", "scheduled_downtime_depth": "0", "problem_has_been_acknowledged": "0", "notifications_enabled": "1", "active_checks_enabled": "1", "current_attempt": "2", "max_attempts": "3", "should_be_scheduled": "1"},
+		{"check_type": "0", "current_state": "2", "state_type": "1", "is_flapping": "0", "scheduled_downtime_depth": "1", "problem_has_been_acknowledged": "1", "notifications_enabled": "0", "active_checks_enabled": "1", "current_attempt": "3", "max_attempts": "3", "should_be_scheduled": "1"},
+		{"check_type": "1", "current_state": "2", "state_type": "0", "is_flapping": "0", "scheduled_downtime_depth": "2", "problem_has_been_acknowledged": "0", "notifications_enabled": "1", "active_checks_enabled": "0", "current_attempt": "1", "max_attempts": "3", "should_be_scheduled": "0"},
+		{"check_type": "1", "current_state": "3", "state_type": "1", "is_flapping": "0", "scheduled_downtime_depth": "0", "problem_has_been_acknowledged": "1", "notifications_enabled": "1", "active_checks_enabled": "0", "current_attempt": "1", "max_attempts": "1", "should_be_scheduled": "0"},
+		{"check_type": "1", "current_state": "0", "state_type": "0", "is_flapping": "0", "scheduled_downtime_depth": "0", "problem_has_been_acknowledged": "0", "notifications_enabled": "1", "active_checks_enabled": "1", "current_attempt": "1", "max_attempts": "3", "should_be_scheduled": "0"},
+		{"check_type": "0", "current_state": "7", "state_type": "1", "is_flapping": "0", "scheduled_downtime_depth": "0", "problem_has_been_acknowledged": "0", "notifications_enabled": "1", "active_checks_enabled": "1", "current_attempt": "1", "max_attempts": "3", "should_be_scheduled": "1"}
+	]
+}`
+
+func TestServiceCounts(t *testing.T) {
+	var serviceStatus struct {
+		Servicestatus []status_counts.Service `json:"servicestatus"`
+	}
+	if err := json.Unmarshal([]byte(serviceStatusJSON), &serviceStatus); err != nil {
+		t.Fatalf("Failed to parse the servicestatus fixture: %v", err)
+	}
+
+	var counts status_counts.ServiceCounts
+	for _, s := range serviceStatus.Servicestatus {
+		counts.Add(s)
+	}
+
+	tests := []struct {
+		name     string
+		got      float64
+		expected float64
+	}{
+		{"total", counts.Total, 7},
+		{"active", counts.Active, 4},
+		{"passive", counts.Passive, 3},
+		{"ok", counts.Ok, 2},
+		{"warn", counts.Warn, 1},
+		{"critical", counts.Critical, 2},
+		{"unknown", counts.Unknown, 1},
+		// the out of range current_state
+		{"pending", counts.Pending, 1},
+		{"every state", counts.Ok + counts.Warn + counts.Critical + counts.Unknown + counts.Pending, counts.Total},
+		{"hard ok", counts.HardOk, 1},
+		{"hard warn", counts.HardWarn, 0},
+		{"hard critical", counts.HardCritical, 1},
+		{"hard unknown", counts.HardUnknown, 1},
+		{"acknowledged ok", counts.AcknowledgedOk, 0},
+		{"acknowledged warn", counts.AcknowledgedWarn, 0},
+		{"acknowledged critical", counts.AcknowledgedCritical, 1},
+		{"acknowledged unknown", counts.AcknowledgedUnknown, 1},
+		{"flapping", counts.Flapping, 1},
+		{"downtime", counts.Downtime, 1},
+		{"notifications disabled", counts.NotificationsDisabled, 1},
+		// actively checked services are scheduled, while the last passive service has active checks enabled
+		// but no check_interval, so it's neither scheduled nor counted as disabled
+		{"checks disabled", counts.ChecksDisabled, 2},
+		{"scheduled", counts.Scheduled, 4},
+		// the soft warning on its second attempt, unlike the soft critical still on its first
+		{"retrying", counts.Retrying, 1},
+	}
+
+	for _, test := range tests {
+		if test.got != test.expected {
+			t.Errorf("Expected %s count %v, but got %v", test.name, test.expected, test.got)
+		}
+	}
+}
+
+func TestServiceState(t *testing.T) {
+	tests := []struct {
+		currentState float64
+		expected     string
+	}{
+		{0, "ok"},
+		{1, "warn"},
+		{2, "critical"},
+		{3, "unknown"},
+		{4, "pending"},
+	}
+
+	for _, test := range tests {
+		if got := status_counts.ServiceState(test.currentState); got != test.expected {
+			t.Errorf("Expected state %v to be %q, but got %q", test.currentState, test.expected, got)
+		}
+	}
+}
+
+func TestHostState(t *testing.T) {
+	tests := []struct {
+		currentState float64
+		expected     string
+	}{
+		{0, "up"},
+		{1, "down"},
+		{2, "unreachable"},
+		{3, "pending"},
+	}
+
+	for _, test := range tests {
+		if got := status_counts.HostState(test.currentState); got != test.expected {
+			t.Errorf("Expected state %v to be %q, but got %q", test.currentState, test.expected, got)
+		}
+	}
+}
+
+func TestRetrying(t *testing.T) {
+	tests := []struct {
+		stateType      float64
+		currentAttempt float64
+		expected       bool
+	}{
+		{0, 1, false},
+		{0, 2, true},
+		// a hard state stays at max_attempts until it recovers
+		{1, 3, false},
+		{1, 1, false},
+	}
+
+	for _, test := range tests {
+		if got := status_counts.Retrying(test.stateType, test.currentAttempt); got != test.expected {
+			t.Errorf("Expected state_type %v at attempt %v to be retrying %v, but got %v", test.stateType, test.currentAttempt, test.expected, got)
+		}
+	}
+}
+
+// the same 4 hosts as a Nagios XI hoststatus response and as Nagios Core status.dat blocks
+const hostStatusJSON = `{
+	"recordcount": "4",
+	"hoststatus": [
+		{"check_type": "0", "current_state": "0", "state_type": "1", "is_flapping": "0", "scheduled_downtime_depth": "0", "problem_has_been_acknowledged": "0", "notifications_enabled": "1", "active_checks_enabled": "1", "current_attempt": "1", "max_attempts": "5"},
+		{"check_type": "0", "current_state": "1", "state_type": "0", "is_flapping": "1", "scheduled_downtime_depth": "2", "problem_has_been_acknowledged": "1", "notifications_enabled": "0", "active_checks_enabled": "1", "current_attempt": "3", "max_attempts": "5"},
+		{"check_type": "1", "current_state": "2", "state_type": "1", "is_flapping": "0", "scheduled_downtime_depth": "1", "problem_has_been_acknowledged": "0", "notifications_enabled": "1", "active_checks_enabled": "0", "current_attempt": "3", "max_attempts": "3"},
+		{"check_type": "0", "current_state": "5", "state_type": "1", "is_flapping": "0", "scheduled_downtime_depth": "0", "problem_has_been_acknowledged": "0", "notifications_enabled": "1", "active_checks_enabled": "1", "current_attempt": "1", "max_attempts": "5"}
+	]
+}`
+
+const hostStatusDat = `hoststatus {
+	host_name=web01
+	check_type=0
+	current_state=0
+	state_type=1
+	is_flapping=0
+	scheduled_downtime_depth=0
+	problem_has_been_acknowledged=0
+	notifications_enabled=1
+	active_checks_enabled=1
+	current_attempt=1
+	max_attempts=5
+	}
+
+hoststatus {
+	host_name=web02
+	check_type=0
+	current_state=1
+	state_type=0
+	is_flapping=1
+	scheduled_downtime_depth=2
+	problem_has_been_acknowledged=1
+	notifications_enabled=0
+	active_checks_enabled=1
+	current_attempt=3
+	max_attempts=5
+	}
+
+hoststatus {
+	host_name=db01
+	check_type=1
+	current_state=2
+	state_type=1
+	is_flapping=0
+	scheduled_downtime_depth=1
+	problem_has_been_acknowledged=0
+	notifications_enabled=1
+	active_checks_enabled=0
+	current_attempt=3
+	max_attempts=3
+	}
+
+hoststatus {
+	host_name=new01
+	check_type=0
+	current_state=5
+	state_type=1
+	is_flapping=0
+	scheduled_downtime_depth=0
+	problem_has_been_acknowledged=0
+	notifications_enabled=1
+	active_checks_enabled=1
+	current_attempt=1
+	max_attempts=5
+	}
+`
+
+func TestHostCounts(t *testing.T) {
+	var hostStatus struct {
+		Hoststatus []status_counts.Host `json:"hoststatus"`
+	}
+	if err := json.Unmarshal([]byte(hostStatusJSON), &hostStatus); err != nil {
+		t.Fatalf("Failed to parse the hoststatus fixture: %v", err)
+	}
+
+	var counts status_counts.HostCounts
+	for _, h := range hostStatus.Hoststatus {
+		counts.Add(h)
+	}
+
+	tests := []struct {
+		name     string
+		got      float64
+		expected float64
+	}{
+		{"total", counts.Total, 4},
+		{"active", counts.Active, 3},
+		{"passive", counts.Passive, 1},
+		{"up", counts.Up, 1},
+		{"down", counts.Down, 1},
+		{"unreachable", counts.Unreachable, 1},
+		// the out of range current_state
+		{"pending", counts.Pending, 1},
+		{"every state", counts.Up + counts.Down + counts.Unreachable + counts.Pending, counts.Total},
+		{"hard up", counts.HardUp, 1},
+		{"hard down", counts.HardDown, 0},
+		{"hard unreachable", counts.HardUnreachable, 1},
+		{"acknowledged down", counts.AcknowledgedDown, 1},
+		{"flapping", counts.Flapping, 1},
+		// only a depth of 1, the nested downtime at depth 2 isn't counted
+		{"downtime", counts.Downtime, 1},
+		{"notifications disabled", counts.NotificationsDisabled, 1},
+		{"checks disabled", counts.ChecksDisabled, 1},
+		{"retrying", counts.Retrying, 1},
+	}
+
+	for _, test := range tests {
+		if test.got != test.expected {
+			t.Errorf("Expected %s count %v, but got %v", test.name, test.expected, test.got)
+		}
+	}
+}
+
+// Nagios Core's status.dat and the Nagios XI API encode check_type and current_state the same way,
+// so the same hosts and services must add up to the same counts from either
+func TestStatusFileCountsMatchAPI(t *testing.T) {
+	var hostStatus struct {
+		Hoststatus []status_counts.Host `json:"hoststatus"`
+	}
+	if err := json.Unmarshal([]byte(hostStatusJSON), &hostStatus); err != nil {
+		t.Fatalf("Failed to parse the hoststatus fixture: %v", err)
+	}
+	var apiHostCounts status_counts.HostCounts
+	for _, h := range hostStatus.Hoststatus {
+		apiHostCounts.Add(h)
+	}
+
+	var serviceStatus struct {
+		Servicestatus []status_counts.Service `json:"servicestatus"`
+	}
+	if err := json.Unmarshal([]byte(serviceStatusJSON), &serviceStatus); err != nil {
+		t.Fatalf("Failed to parse the servicestatus fixture: %v", err)
+	}
+	var apiServiceCounts status_counts.ServiceCounts
+	for _, s := range serviceStatus.Servicestatus {
+		apiServiceCounts.Add(s)
+	}
+
+	blocks, err := parse_statusdat.Parse(strings.NewReader(hostStatusDat + serviceStatusDat(serviceStatus.Servicestatus)))
+	if err != nil {
+		t.Fatalf("Failed to parse the status.dat fixture: %v", err)
+	}
+
+	var fileHostCounts status_counts.HostCounts
+	var fileServiceCounts status_counts.ServiceCounts
+	for _, block := range blocks {
+		switch block.Type {
+		case "hoststatus":
+			fileHostCounts.Add(status_counts.HostFromStatusFile(block.Fields))
+		case "servicestatus":
+			fileServiceCounts.Add(status_counts.ServiceFromStatusFile(block.Fields))
+		}
+	}
+
+	if fileHostCounts != apiHostCounts {
+		t.Errorf("Expected status.dat host counts %+v to match the API's %+v", fileHostCounts, apiHostCounts)
+	}
+	if fileServiceCounts != apiServiceCounts {
+		t.Errorf("Expected status.dat service counts %+v to match the API's %+v", fileServiceCounts, apiServiceCounts)
+	}
+}
+
+// the servicestatus fixture as status.dat blocks, written the way Nagios Core does
+func serviceStatusDat(services []status_counts.Service) string {
+	var b strings.Builder
+	for _, s := range services {
+		b.WriteString("servicestatus {\n")
+		for _, field := range []struct {
+			name  string
+			value float64
+		}{
+			{"check_type", s.CheckType},
+			{"current_state", s.CurrentState},
+			{"state_type", s.StateType},
+			{"is_flapping", s.IsFlapping},
+			{"scheduled_downtime_depth", s.ScheduledDowntimeDepth},
+			{"problem_has_been_acknowledged", s.ProblemHasBeenAcknowledged},
+			{"notifications_enabled", s.NotificationsEnabled},
+			{"active_checks_enabled", s.ActiveChecksEnabled},
+			{"should_be_scheduled", s.ShouldBeScheduled},
+			{"current_attempt", s.CurrentAttempt},
+			{"max_attempts", s.MaxAttempts},
+		} {
+			fmt.Fprintf(&b, "\t%s=%v\n", field.name, field.value)
+		}
+		b.WriteString("\t}\n\n")
+	}
+	return b.String()
+}
+
+func TestCheckType(t *testing.T) {
+	tests := []struct {
+		checkType float64
+		expected  string
+	}{
+		{0, "active"},
+		{1, "passive"},
+	}
+
+	for _, test := range tests {
+		if got := status_counts.CheckType(test.checkType); got != test.expected {
+			t.Errorf("Expected check_type %v to be %q, but got %q", test.checkType, test.expected, got)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/linode-obs/nagios_exporter/get_nagios_version"
+)
+
+func TestUpdateAvailable(t *testing.T) {
+	tests := []struct {
+		name           string
+		latestVersion  string
+		currentVersion string
+		expected       bool
+		expectError    bool
+	}{
+		{"equal", "xi-5.9.3", "5.9.3", false, false},
+		{"older current version", "xi-5.9.3", "5.9.2", true, false},
+		{"newer current version", "xi-5.9.2", "5.9.3", false, false},
+		{"minor and major updates", "xi-5.10.0", "5.9.3", true, false},
+		{"prefix on both versions", "xi-5.9.3", "xi-5.9.2", true, false},
+		{"empty latest version", "", "5.9.3", false, true},
+		{"garbage latest version", "xi-garbage", "5.9.3", false, true},
+		{"malformed latest version", "<html>", "5.9.3", false, true},
+		{"empty current version", "xi-5.9.3", "", false, true},
+		{"malformed current version", "xi-5.9.3", "five", false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := get_nagios_version.UpdateAvailable(tt.latestVersion, tt.currentVersion)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected an error comparing %q to %q, but got none", tt.latestVersion, tt.currentVersion)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+
+			if result != tt.expected {
+				t.Errorf("Expected %v comparing %q to %q, but got %v", tt.expected, tt.latestVersion, tt.currentVersion, result)
+			}
+		})
+	}
+}